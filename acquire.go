@@ -0,0 +1,39 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Acquire is AllocCtx returning also the function releasing the buffer. The
+// pool then serves as a semaphore, like golang.org/x/sync/semaphore, which
+// admits at most as many holders as it has buffers and which hands each of
+// them its buffer: a server limits its concurrency and obtains the per
+// request buffer in one call, blocking, honoring ctx, and releasing both at
+// once.
+//
+//	buf, release, err := p.Acquire(ctx, n)
+//	if err != nil {
+//		return err // Overloaded or canceled.
+//	}
+//
+//	defer release()
+//
+// release frees the buffer. It must be called after the last use of buf.
+// Calls of release after the first one do nothing.
+func (p *Pool) Acquire(ctx context.Context, n int) (buf []byte, release func(), err error) {
+	if buf, err = p.AllocCtx(ctx, n); err != nil {
+		return nil, nil, err
+	}
+
+	var done atomic.Bool
+	return buf, func() {
+		if done.CompareAndSwap(false, true) {
+			p.Free(buf)
+		}
+	}, nil
+}
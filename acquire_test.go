@@ -0,0 +1,38 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	p := NewPool(1, nil)
+	buf, release, err := p.Acquire(context.Background(), 10)
+	if err != nil || len(buf) != 10 {
+		t.Fatal(len(buf), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.Acquire(ctx, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+
+	release()
+	release()
+	if n, _ := p.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, release, err = p.Acquire(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	release()
+}
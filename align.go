@@ -0,0 +1,61 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// AllocAligned is like Alloc, but the address of the first byte of the
+// returned buffer is a multiple of align, which must be a power of 2. Free
+// buffers are reused only if they can provide the alignment, so aligned and
+// unaligned requests can be freely mixed. The MinAlignment option, if bigger,
+// takes precedence over align.
+func (p *Stack) AllocAligned(n, align int) []byte {
+	if align <= 0 || align&(align-1) != 0 {
+		panic(errors.New("Stack.AllocAligned: invalid alignment"))
+	}
+
+	align = max(align, p.minAlign)
+	if r, done := p.prologue("AllocAligned", n, align); done {
+		return r
+	}
+
+	i, ok := p.pick(n, align)
+	return p.alloc(i, n, align, ok)
+}
+
+// Alignment returns the biggest power of 2 the address of the first byte of b
+// is a multiple of, or zero if b has no backing array. The buffers allocated
+// by make are usually aligned to at least 8 bytes, but code relying on a
+// bigger alignment, like SIMD code needing 16 or 32 bytes, must not assume
+// it. See AllocAligned and the MinAlignment option.
+func Alignment(b []byte) int { return alignOf(b) }
+
+// alignOf returns the biggest power of 2 the address of b's backing array is
+// a multiple of, or zero if b has no backing array.
+func alignOf(b []byte) int {
+	if cap(b) == 0 {
+		return 0
+	}
+
+	a := uintptr(unsafe.Pointer(&b[:1][0]))
+	return int(a & -a)
+}
+
+// padding returns the number of bytes to skip at the start of the slot
+// buffer to make it aligned to align.
+func (s *slot) padding(align int) int {
+	if align <= s.align || cap(s.b) == 0 {
+		return 0
+	}
+
+	return int(-uintptr(unsafe.Pointer(&s.b[:1][0])) & uintptr(align-1))
+}
+
+// avail returns the capacity of the slot buffer usable for a buffer aligned
+// to align.
+func (s *slot) avail(align int) int { return max(cap(s.b)-s.padding(align), 0) }
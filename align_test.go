@@ -0,0 +1,99 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAllocAligned(t *testing.T) {
+	b := NewStack(2)
+	for i := 0; i < 100; i++ {
+		for _, align := range []int{1, 64, 4096, 8, 1} {
+			n := 1 + (i*align)%1000
+			r := b.AllocAligned(n, align)
+			if g, e := len(r), n; g != e {
+				t.Fatal(g, e)
+			}
+
+			if alignOf(r) < align {
+				t.Fatal(i, n, align, alignOf(r))
+			}
+
+			u := b.Alloc(n)
+			if g, e := len(u), n; g != e {
+				t.Fatal(g, e)
+			}
+
+			b.Free()
+			b.Free()
+		}
+	}
+	if b.Stats() > 2*(2*4096+2*1000) {
+		t.Fatal(b.Stats())
+	}
+}
+
+func TestMinAlignment(t *testing.T) {
+	var a [64]byte
+	for i := range 32 {
+		if g := Alignment(a[i:]); g == 0 || int(addr(a[i:]))%g != 0 || int(addr(a[i:]))%(2*g) == 0 {
+			t.Fatal(i, g)
+		}
+	}
+	if g := Alignment(nil); g != 0 {
+		t.Fatal(g)
+	}
+
+	for _, align := range []int{16, 32, 64} {
+		b := NewWithOptions(3, &Options{MinAlignment: align, LargeThreshold: 1000})
+		for i := range 100 {
+			n := 1 + i*37%2000
+			r := b.Alloc(n)
+			if g, e := len(r), n; g != e {
+				t.Fatal(g, e)
+			}
+
+			if g := Alignment(r); g < align {
+				t.Fatal(align, n, g)
+			}
+
+			if r := b.AllocAligned(n, 1); Alignment(r) < align {
+				t.Fatal(align, n, Alignment(r))
+			}
+
+			b.Free()
+			b.Free()
+		}
+	}
+
+	if recovered(func() { NewWithOptions(1, &Options{MinAlignment: 24}) }) == nil {
+		t.Fatal("expected panic")
+	}
+}
+
+func TestAllocAlignedOptions(t *testing.T) {
+	b := Make(WithSlots(2), WithZeroAlloc(ZeroAllocEmpty), WithLargeThreshold(100))
+	if r := b.AllocAligned(0, 16); cap(r) != 0 || b.Depth() != 0 {
+		t.Fatal(cap(r), b.Depth())
+	}
+
+	r := b.AllocAligned(1000, 64)
+	if len(r) != 1000 || Alignment(r) < 64 {
+		t.Fatal(len(r), Alignment(r))
+	}
+
+	b.Free()
+	if g := b.Stats(); g != 0 {
+		t.Fatal("large buffer retained", g)
+	}
+
+	b = Make(WithSlots(4), WithFailEveryN(2))
+	b.AllocAligned(10, 16)
+	if err := recovered(func() { b.AllocAligned(10, 16) }); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// Allocator is the common interface of the get/put style caches of this
+// package, like CCache and LFCache. Get returns a buffer of length n, Put
+// makes a buffer obtained from Get available for reuse.
+type Allocator interface {
+	Get(n int) []byte
+	Put(b []byte)
+}
+
+// TryAllocator is an Allocator which can refuse to allocate. TryGet returns a
+// buffer of length n and true if it can do so cheaply, otherwise it reports
+// false. See Compose.
+type TryAllocator interface {
+	Allocator
+	TryGet(n int) ([]byte, bool)
+}
+
+// Heap is an Allocator using plain make. Put does nothing.
+type Heap struct{}
+
+// Get implements Allocator.
+func (Heap) Get(n int) []byte {
+	checkSize("Heap.Get", n)
+	return make([]byte, n)
+}
+
+// Put implements Allocator.
+func (Heap) Put([]byte) {}
+
+var (
+	_ Allocator    = Heap{}
+	_ TryAllocator = (*Cache)(nil)
+	_ TryAllocator = (*CCache)(nil)
+	_ TryAllocator = (*LFCache)(nil)
+	_ TryAllocator = (*ShardedCache)(nil)
+	_ TryAllocator = (*Composite)(nil)
+)
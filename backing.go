@@ -0,0 +1,49 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+)
+
+// makeBuf returns a new buffer of length n and capacity c. If the Backing
+// option is set, the buffer is obtained from it instead, with capacity of at
+// least need, leaving the overcommit to the Backing.
+func (p *Stack) makeBuf(n, need, c int) []byte {
+	if p.backing == nil {
+		r := makeBuf(p.labels, n, c)
+		if p.touch {
+			touchPages(r)
+		}
+		return r
+	}
+
+	return p.backing.Get(need)[:n]
+}
+
+// release puts b, a buffer no longer retained, back to the Backing option, if
+// set. In the DetectEscapes mode no buffer comes from Backing, so none goes
+// back to it.
+func (p *Stack) release(b []byte) {
+	if p.backing != nil && p.esc == nil && cap(b) != 0 {
+		p.backing.Put(b)
+	}
+}
+
+// Close drops all free buffers, putting them back to the Backing option, if
+// set. It fails if any buffer is allocated. The Stack remains usable, new
+// buffers are obtained again as needed.
+func (p *Stack) Close() error {
+	if d := p.Depth(); d != 0 {
+		return fmt.Errorf("Stack.Close: %d buffer(s) allocated", d)
+	}
+
+	for i := range p.s {
+		if s := &p.s[i]; s.b != nil {
+			p.drop(s, SlotTrimmed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestBacking(t *testing.T) {
+	var c CCache
+	c.Put(make([]byte, 1000))
+	b := NewWithOptions(2, &Options{Backing: &c})
+	x := b.Alloc(100)
+	if n, _ := c.Stats(); n != 0 || cap(x) != 1000 {
+		t.Fatal(n, cap(x))
+	}
+
+	b.Alloc(10)
+	if err := b.Close(); err == nil {
+		t.Fatal("closed with allocated buffers")
+	}
+
+	b.Free()
+	b.Free()
+	if n, _ := c.Stats(); n != 0 {
+		t.Fatal(n)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, bytes := c.Stats(); n != 2 || bytes != 1020 || b.Stats() != 0 {
+		t.Fatal(n, bytes, b.Stats())
+	}
+}
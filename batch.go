@@ -0,0 +1,110 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Batch is a sequence of messages, like the ones a producer of a message
+// queue collects before sending them at once. The messages are copied into
+// chunks obtained from the Allocator of the BatchPool and Msgs refers to the
+// copies. A Batch is not safe for concurrent use by multiple goroutines.
+type Batch struct {
+	// Msgs are the appended messages. They are valid until the Batch is
+	// put back to its pool.
+	Msgs [][]byte
+
+	chunks [][]byte // Obtained from p.a.
+	free   []byte   // Unused part of the last chunk.
+	p      *BatchPool
+}
+
+// Append copies msg to b and appends the copy to b.Msgs. The copy is
+// returned. A message not fitting in a chunk gets a buffer of its own.
+func (b *Batch) Append(msg []byte) []byte {
+	if len(msg) > len(b.free) {
+		c := b.p.a.Get(max(len(msg), b.p.chunkSize))
+		b.chunks = append(b.chunks, c)
+		b.free = c
+	}
+	r := b.free[:len(msg):len(msg)]
+	copy(r, msg)
+	b.free = b.free[len(msg):]
+	b.Msgs = append(b.Msgs, r)
+	return r
+}
+
+// Len returns the number of messages in b.
+func (b *Batch) Len() int { return len(b.Msgs) }
+
+// Size returns the combined length of the messages in b.
+func (b *Batch) Size() (n int) {
+	for _, m := range b.Msgs {
+		n += len(m)
+	}
+	return n
+}
+
+// Release puts b back to its pool, see BatchPool.Put.
+func (b *Batch) Release() { b.p.Put(b) }
+
+// BatchPool lends Batches. The header slices of the Batches are reused by
+// the pool and the message payloads are stored in chunks obtained from an
+// Allocator, so assembling a Batch of the usual size allocates nothing once
+// the pool is warm. All the memory of a Batch is released at once by Put.
+//
+// A BatchPool is safe for concurrent use by multiple goroutines if its
+// Allocator is.
+type BatchPool struct {
+	a         Allocator
+	chunkSize int
+	mu        sync.Mutex
+	batches   []*Batch
+}
+
+// NewBatchPool returns a newly created BatchPool storing the messages in
+// chunks of chunkSize bytes obtained from a. If a is nil, GCache is used.
+func NewBatchPool(a Allocator, chunkSize int) *BatchPool {
+	if a == nil {
+		a = &GCache
+	}
+	return &BatchPool{a: a, chunkSize: chunkSize}
+}
+
+// Get returns an empty Batch.
+func (p *BatchPool) Get() *Batch {
+	p.mu.Lock()
+	if n := len(p.batches); n != 0 {
+		b := p.batches[n-1]
+		p.batches[n-1] = nil
+		p.batches = p.batches[:n-1]
+		p.mu.Unlock()
+		return b
+	}
+
+	p.mu.Unlock()
+	return &Batch{p: p}
+}
+
+// Put returns the chunks of b to the Allocator and keeps the emptied b for
+// reuse. b and its messages must not be used afterwards. Put panics with
+// ErrForeign if b was not obtained from p.
+func (p *BatchPool) Put(b *Batch) {
+	if b.p != p {
+		panic(fmt.Errorf("BatchPool.Put: %w", ErrForeign))
+	}
+
+	for i, c := range b.chunks {
+		p.a.Put(c)
+		b.chunks[i] = nil
+	}
+	clear(b.Msgs)
+	b.Msgs, b.chunks, b.free = b.Msgs[:0], b.chunks[:0], nil
+	p.mu.Lock()
+	p.batches = append(p.batches, b)
+	p.mu.Unlock()
+}
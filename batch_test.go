@@ -0,0 +1,64 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBatchPool(t *testing.T) {
+	var c Cache
+	p := NewBatchPool(&c, 16)
+	b := p.Get()
+	msg := []byte("0123456789")
+	for range 3 {
+		b.Append(msg)
+	}
+	b.Append(bytes.Repeat(msg, 3))
+	if g, e := b.Len(), 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Size(), 60; g != e {
+		t.Fatal(g, e)
+	}
+
+	for _, m := range b.Msgs[:3] {
+		if !bytes.Equal(m, msg) || cap(m) != len(m) {
+			t.Fatalf("%q %d", m, cap(m))
+		}
+	}
+	if g, e := len(b.chunks), 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Release()
+	if g, e := len(c), 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	if raceEnabled {
+		t.Skip("allocations not reliable with the race detector")
+	}
+
+	if g := testing.AllocsPerRun(100, func() {
+		b := p.Get()
+		for range 10 {
+			b.Append(msg)
+		}
+		p.Put(b)
+	}); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestBatchPoolForeign(t *testing.T) {
+	p, q := NewBatchPool(Heap{}, 16), NewBatchPool(Heap{}, 16)
+	if err := recovered(func() { q.Put(p.Get()) }); !errors.Is(err, ErrForeign) {
+		t.Fatal(err)
+	}
+}
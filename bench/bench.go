@@ -0,0 +1,200 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bench compares buffer allocators under concurrent load.
+//
+// Run drives a bufs.Allocator, or one allocator per goroutine, with a
+// configurable number of goroutines and a distribution of request sizes and
+// reports the throughput and how much of the requested memory was actually
+// allocated from the heap. Comparing the reports of, for example, bufs.CCache,
+// a sync.Pool and per goroutine bufs.Stack for a given workload helps to
+// choose the right tool before committing to it.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cznic/bufs"
+)
+
+// Config describes a workload.
+type Config struct {
+	// Goroutines is the number of goroutines using the allocator. Values
+	// < 1 mean runtime.GOMAXPROCS(0).
+	Goroutines int
+
+	// Ops is the number of Get/Put pairs performed by every goroutine.
+	Ops int
+
+	// Size returns the size of the next request. If nil, all requests are
+	// 4096 bytes.
+	Size func(r *rand.Rand) int
+
+	// Work, if not nil, is called with every buffer between Get and Put.
+	Work func(b []byte)
+
+	// Depth is the number of nested Gets of every op of Run, the buffers
+	// put back in the reverse order, like in recursive code. Values < 1
+	// mean 1.
+	Depth int
+}
+
+// Report is the result of Run.
+type Report struct {
+	Name       string
+	Goroutines int
+	Ops        int           // Total ops, each of Depth Get/Put pairs.
+	Elapsed    time.Duration // Wall time.
+	Requested  uint64        // Total bytes requested by Get.
+	Allocated  uint64        // Heap bytes allocated during the run.
+	Mallocs    uint64        // Heap objects allocated during the run.
+}
+
+// NsPerOp returns the wall time per op.
+func (r *Report) NsPerOp() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+
+	return float64(r.Elapsed.Nanoseconds()) / float64(r.Ops)
+}
+
+// HitRate estimates the fraction of requested bytes served by the allocator
+// without allocating from the heap.
+func (r *Report) HitRate() float64 {
+	if r.Requested == 0 || r.Allocated >= r.Requested {
+		return 0
+	}
+
+	return 1 - float64(r.Allocated)/float64(r.Requested)
+}
+
+// Run runs the workload c against an allocator. newAllocator is called
+// once per goroutine if perGoroutine is set, otherwise all goroutines share
+// a single allocator. The latter requires an allocator safe for concurrent
+// use.
+func Run(name string, newAllocator func() bufs.Allocator, perGoroutine bool, c Config) Report {
+	g := c.Goroutines
+	if g < 1 {
+		g = runtime.GOMAXPROCS(0)
+	}
+	size := c.Size
+	if size == nil {
+		size = func(*rand.Rand) int { return 4096 }
+	}
+
+	depth := max(c.Depth, 1)
+	var shared bufs.Allocator
+	if !perGoroutine {
+		shared = newAllocator()
+	}
+	requested := make([]uint64, g)
+	var wg, start sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < g; i++ {
+		a := shared
+		if perGoroutine {
+			a = newAllocator()
+		}
+		rng := rand.New(rand.NewSource(int64(i)))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			held := make([][]byte, depth)
+			start.Wait()
+			var n uint64
+			for j := 0; j < c.Ops; j++ {
+				for k := range held {
+					sz := size(rng)
+					held[k] = a.Get(sz)
+					if c.Work != nil {
+						c.Work(held[k])
+					}
+					n += uint64(sz)
+				}
+				for k := len(held) - 1; k >= 0; k-- {
+					a.Put(held[k])
+				}
+			}
+			requested[i] = n
+		}(i)
+	}
+
+	var m0, m1 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m0)
+	t0 := time.Now()
+	start.Done()
+	wg.Wait()
+	elapsed := time.Since(t0)
+	runtime.ReadMemStats(&m1)
+	r := Report{
+		Name:       name,
+		Goroutines: g,
+		Ops:        g * c.Ops,
+		Elapsed:    elapsed,
+		Allocated:  m1.TotalAlloc - m0.TotalAlloc,
+		Mallocs:    m1.Mallocs - m0.Mallocs,
+	}
+	for _, v := range requested {
+		r.Requested += v
+	}
+	return r
+}
+
+// Print writes a table of reports to w. A growing ns/op with a growing number
+// of goroutines for the same allocator indicates contention.
+func Print(w io.Writer, reports ...Report) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "allocator\tgoroutines\tops\tns/op\thit rate\theap MB\tmallocs\t\n")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.1f%%\t%.1f\t%d\t\n", r.Name, r.Goroutines, r.Ops, r.NsPerOp(), 100*r.HitRate(), float64(r.Allocated)/(1<<20), r.Mallocs)
+	}
+	return tw.Flush()
+}
+
+// SyncPool adapts a sync.Pool of *[]byte to bufs.Allocator.
+type SyncPool struct {
+	p sync.Pool
+}
+
+// Get implements bufs.Allocator.
+func (p *SyncPool) Get(n int) []byte {
+	if b, ok := p.p.Get().(*[]byte); ok && cap(*b) >= n {
+		return (*b)[:n]
+	}
+
+	return make([]byte, n)
+}
+
+// Put implements bufs.Allocator.
+func (p *SyncPool) Put(b []byte) { p.p.Put(&b) }
+
+// Stack adapts bufs.Stack to bufs.Allocator. It's not safe for concurrent
+// use and Put must be called in the reverse order of Get.
+type Stack struct {
+	B bufs.Stack
+}
+
+// Get implements bufs.Allocator.
+func (s *Stack) Get(n int) []byte { return s.B.Alloc(n) }
+
+// Put implements bufs.Allocator.
+func (s *Stack) Put([]byte) { s.B.Free() }
+
+// Make is a bufs.Allocator which does not cache anything, for comparison.
+type Make struct{}
+
+// Get implements bufs.Allocator.
+func (Make) Get(n int) []byte { return make([]byte, n) }
+
+// Put implements bufs.Allocator.
+func (Make) Put([]byte) {}
@@ -0,0 +1,56 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/cznic/bufs"
+)
+
+func TestRun(t *testing.T) {
+	c := Config{
+		Goroutines: 4,
+		Ops:        1000,
+		Size:       func(r *rand.Rand) int { return 1 + r.Intn(1<<14) },
+	}
+	var reports []Report
+	reports = append(reports, Run("make", func() bufs.Allocator { return Make{} }, false, c))
+	reports = append(reports, Run("CCache", func() bufs.Allocator { return &bufs.CCache{} }, false, c))
+	reports = append(reports, Run("sync.Pool", func() bufs.Allocator { return &SyncPool{} }, false, c))
+	reports = append(reports, Run("Stack", func() bufs.Allocator { return &Stack{bufs.NewStack(1)} }, true, c))
+	for _, r := range reports {
+		if g, e := r.Ops, 4000; g != e {
+			t.Fatal(r.Name, g, e)
+		}
+	}
+
+	if g := reports[1].HitRate(); g < 0.5 {
+		t.Fatal(g)
+	}
+
+	var buf bytes.Buffer
+	if err := Print(&buf, reports...); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("\n%s", buf.Bytes())
+}
+
+func TestCompare(t *testing.T) {
+	c := Config{Goroutines: 2, Ops: 100, Depth: 3}
+	reports := Compare(c, Candidates(c, &bufs.Options{Policy: bufs.LRU}))
+	for _, r := range reports {
+		if g, e := r.Ops, 200; g != e {
+			t.Fatal(r.Name, g, e)
+		}
+
+		if g, e := r.Requested, uint64(3*200*4096); g != e {
+			t.Fatal(r.Name, g, e)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cznic/bufs"
+)
+
+// Limits are the invariants RunSoak asserts.
+type Limits struct {
+	// MaxBytes, if positive, is the maximum combined capacity of the
+	// buffers held by the pool, allocated and retained, at any time.
+	MaxBytes int
+
+	// MinHitRate is the minimum fraction of allocations served by a
+	// retained buffer over the whole run.
+	MinHitRate float64
+}
+
+// RunSoak drives the workload c against p for the duration d and reports
+// violations of l through tb. Config.Ops is ignored, the goroutines allocate
+// and free until d elapses. RunSoak returns the final metrics of p.
+//
+// RunSoak is meant for Go tests guarding the configuration of a pool, for
+// example its size and thresholds, against regressions.
+func RunSoak(tb testing.TB, p *bufs.Pool, c Config, d time.Duration, l Limits) bufs.PoolMetrics {
+	tb.Helper()
+	g := c.Goroutines
+	if g < 1 {
+		g = runtime.GOMAXPROCS(0)
+	}
+	size := c.Size
+	if size == nil {
+		size = func(*rand.Rand) int { return 4096 }
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	var inUse atomic.Int64 // Combined capacity of the allocated buffers.
+	var mu sync.Mutex
+	var failure error
+	fail := func(err error) {
+		mu.Lock()
+		if failure == nil {
+			failure = err
+		}
+		mu.Unlock()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < g; i++ {
+		rng := rand.New(rand.NewSource(int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				b, err := p.AllocCtx(ctx, size(rng))
+				if err != nil {
+					if ctx.Err() == nil {
+						fail(err)
+					}
+					return
+				}
+
+				inUse.Add(int64(cap(b)))
+				if c.Work != nil {
+					c.Work(b)
+				}
+				inUse.Add(-int64(cap(b)))
+				p.Free(b)
+			}
+		}()
+	}
+
+	peak := int64(0)
+	tick := time.NewTicker(max(d/100, time.Millisecond))
+	defer tick.Stop()
+	sample := func() {
+		if held := p.Metrics().RetainedBytes + inUse.Load(); held > peak {
+			peak = held
+		}
+	}
+	for done := false; !done; {
+		select {
+		case <-tick.C:
+			sample()
+		case <-ctx.Done():
+			done = true
+		}
+	}
+	wg.Wait()
+	sample()
+	if failure != nil {
+		tb.Errorf("RunSoak: %v", failure)
+	}
+
+	m := p.Metrics()
+	if l.MaxBytes > 0 && peak > int64(l.MaxBytes) {
+		tb.Errorf("RunSoak: pool held %d bytes, limit %d", peak, l.MaxBytes)
+	}
+	if n := m.Hits + m.Misses; n != 0 {
+		if rate := float64(m.Hits) / float64(n); rate < l.MinHitRate {
+			tb.Errorf("RunSoak: hit rate %.3f, limit %.3f", rate, l.MinHitRate)
+		}
+	}
+	return m
+}
@@ -0,0 +1,25 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cznic/bufs"
+)
+
+func TestRunSoak(t *testing.T) {
+	p := bufs.NewPool(4, nil)
+	c := Config{
+		Goroutines: 8,
+		Size:       func(r *rand.Rand) int { return 1 + r.Intn(1<<10) },
+	}
+	m := RunSoak(t, p, c, 100*time.Millisecond, Limits{MaxBytes: 8 << 12, MinHitRate: 0.9})
+	if m.Hits == 0 || m.InUse != 0 {
+		t.Fatalf("%+v", m)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/cznic/bufs"
+)
+
+// Candidate is an allocator compared by Compare.
+type Candidate struct {
+	Name string
+
+	// New returns a new instance of the allocator.
+	New func() bufs.Allocator
+
+	// PerGoroutine selects an instance per goroutine, see Run.
+	PerGoroutine bool
+}
+
+// Candidates returns the allocators of this package and of package bufs
+// sized for the workload c. The bufs.Stack and bufs.Pool candidates are
+// configured by o, which may be nil.
+//
+//   - make: no caching, the baseline, like Foo in the tests of package bufs.
+//   - sync.Pool: see SyncPool.
+//   - CCache: a shared bufs.CCache.
+//   - ShardedCache: a shared bufs.ShardedCache with a shard per P.
+//   - Stack: a bufs.Stack of Depth slots per goroutine, like FooBufs.
+//   - Pool: a shared bufs.Pool with Depth buffers per goroutine.
+func Candidates(c Config, o *bufs.Options) []Candidate {
+	depth := max(c.Depth, 1)
+	g := c.Goroutines
+	if g < 1 {
+		g = runtime.GOMAXPROCS(0)
+	}
+	return []Candidate{
+		{Name: "make", New: func() bufs.Allocator { return Make{} }},
+		{Name: "sync.Pool", New: func() bufs.Allocator { return &SyncPool{} }},
+		{Name: "CCache", New: func() bufs.Allocator { return &bufs.CCache{} }},
+		{Name: "ShardedCache", New: func() bufs.Allocator { return bufs.NewShardedCache(0) }},
+		{Name: "Stack", New: func() bufs.Allocator { return &Stack{bufs.NewWithOptions(depth, o)} }, PerGoroutine: true},
+		{Name: "Pool", New: func() bufs.Allocator { return &Pool{bufs.NewPool(g*depth, o)} }},
+	}
+}
+
+// Compare runs the workload c against every candidate and returns the
+// reports in the same order. Print them to compare the allocators.
+func Compare(c Config, candidates []Candidate) []Report {
+	r := make([]Report, len(candidates))
+	for i, v := range candidates {
+		r[i] = Run(v.Name, v.New, v.PerGoroutine, c)
+	}
+	return r
+}
+
+// Pool adapts bufs.Pool to bufs.Allocator. Get blocks while all buffers of
+// the pool are allocated.
+type Pool struct {
+	P *bufs.Pool
+}
+
+// Get implements bufs.Allocator.
+func (p *Pool) Get(n int) []byte {
+	b, err := p.P.AllocCtx(context.Background(), n)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// Put implements bufs.Allocator.
+func (p *Pool) Put(b []byte) { p.P.Free(b) }
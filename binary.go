@@ -0,0 +1,47 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"encoding/binary"
+)
+
+// The encoding/binary scratch helpers below encode a value into a buffer
+// obtained by Alloc and return the encoded bytes. They replace the small
+// scratch arrays encoders allocate. As with Alloc, the result is valid until
+// the matching Free.
+
+// PutUvarint returns the varint encoding of x, see binary.PutUvarint.
+func (p *Stack) PutUvarint(x uint64) []byte {
+	b := p.Alloc(binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, x)]
+}
+
+// PutVarint returns the varint encoding of x, see binary.PutVarint.
+func (p *Stack) PutVarint(x int64) []byte {
+	b := p.Alloc(binary.MaxVarintLen64)
+	return b[:binary.PutVarint(b, x)]
+}
+
+// PutUint16 returns the encoding of v in order.
+func (p *Stack) PutUint16(order binary.ByteOrder, v uint16) []byte {
+	b := p.Alloc(2)
+	order.PutUint16(b, v)
+	return b
+}
+
+// PutUint32 returns the encoding of v in order.
+func (p *Stack) PutUint32(order binary.ByteOrder, v uint32) []byte {
+	b := p.Alloc(4)
+	order.PutUint32(b, v)
+	return b
+}
+
+// PutUint64 returns the encoding of v in order.
+func (p *Stack) PutUint64(order binary.ByteOrder, v uint64) []byte {
+	b := p.Alloc(8)
+	order.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,31 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestBinary(t *testing.T) {
+	b := NewStack(1)
+	for _, test := range []struct {
+		f func() []byte
+		e []byte
+	}{
+		{func() []byte { return b.PutUvarint(300) }, binary.AppendUvarint(nil, 300)},
+		{func() []byte { return b.PutVarint(-300) }, binary.AppendVarint(nil, -300)},
+		{func() []byte { return b.PutUint16(binary.BigEndian, 0x102) }, []byte{1, 2}},
+		{func() []byte { return b.PutUint32(binary.LittleEndian, 0x1020304) }, []byte{4, 3, 2, 1}},
+		{func() []byte { return b.PutUint64(binary.BigEndian, 0x102030405060708) }, []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+	} {
+		if g, e := test.f(), test.e; !bytes.Equal(g, e) {
+			t.Fatal(g, e)
+		}
+
+		b.Free()
+	}
+}
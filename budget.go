@@ -0,0 +1,56 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+)
+
+// checkBudget makes sure allocating a new buffer of capacity c, replacing the
+// buffer of s, keeps the Stack within the Budget option. If it would not,
+// checkBudget first sheds all free buffers, then reports the shortage to the
+// OnPressure callback and if the Stack is still over budget, it panics
+// with an error satisfying errors.Is(err, ErrOverBudget). op is the public
+// method allocating the buffer.
+func (p *Stack) checkBudget(op string, c int, s *slot) {
+	if p.budget <= 0 {
+		return
+	}
+
+	// The Stack is within the budget before the allocation, so the
+	// overrun never exceeds c and fits an int.
+	over := func() int { return int(p.bytes - int64(cap(s.b)-c) - int64(p.budget)) }
+	if over() <= 0 {
+		return
+	}
+
+	p.shed()
+	if over() <= 0 {
+		return
+	}
+
+	if p.onPressure != nil {
+		p.onPressure(over())
+		if over() <= 0 {
+			return
+		}
+	}
+
+	p.fail(fmt.Errorf("Stack.%s: allocating %d bytes, %d over budget: %w", op, c, over(), ErrOverBudget))
+}
+
+// shed drops all free buffers and reports them to the OnEvict callback.
+func (p *Stack) shed() {
+	evicted := 0
+	for i := range p.s {
+		if s := &p.s[i]; s.b != nil {
+			evicted += cap(s.b)
+			p.drop(s, SlotTrimmed)
+		}
+	}
+	if evicted != 0 && p.onEvict != nil {
+		p.onEvict(evicted)
+	}
+}
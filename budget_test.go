@@ -0,0 +1,50 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	for _, v := range []struct {
+		budget  int
+		evicted int
+		need    int
+	}{
+		{520, 0, 0},
+		{500, 60, 0},
+		{450, 60, 50},
+	} {
+		var evicted, need int
+		b := NewWithOptions(4, &Options{
+			Budget:     v.budget,
+			OnEvict:    func(n int) { evicted += n },
+			OnPressure: func(n int) { need = n },
+		})
+		b.Alloc(100) // cap 200
+		b.Alloc(10)  // cap 20
+		b.Alloc(20)  // cap 40
+		b.Free()
+		b.Free()
+		err := recovered(func() { b.Alloc(150) }) // cap 300, replacing the 40
+		if g, e := evicted, v.evicted; g != e {
+			t.Fatal(v.budget, g, e)
+		}
+
+		if g, e := need, v.need; g != e {
+			t.Fatal(v.budget, g, e)
+		}
+
+		if g, e := errors.Is(err, ErrOverBudget), v.need != 0; g != e {
+			t.Fatal(v.budget, err)
+		}
+
+		if err == nil && b.Stats() > int64(v.budget) {
+			t.Fatal(v.budget, b.Stats())
+		}
+	}
+}
@@ -79,7 +79,6 @@
 //
 //	$ make demo # same as all of the above
 //
-//
 // NOTE: Alloc/Free calls must be properly nested in the same way as in for
 // example BeginTransaction/EndTransaction pairs. If your code can panic then
 // the pairing should be enforced by deferred calls.
@@ -87,6 +86,11 @@
 // NOTE: Buffers objects do not allocate any space until requested by Alloc,
 // the mechanism works on demand only.
 //
+// Stack is a buffer cache following the same Alloc/Free discipline as
+// Buffers. Unlike Buffers, it's an opaque struct carrying the state of the
+// Options, of the replacement policies, of the debug modes and of the
+// statistics. Create it by NewStack, NewWithOptions or Make.
+//
 // FAQ: Why the 'bufs' package name?
 //
 // Package name 'bufs' was intentionally chosen instead of the perhaps more
@@ -97,8 +101,14 @@ package bufs
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
 	"sort"
 	"sync"
+	"time"
 )
 
 // Buffers type represents a buffer ([]byte) cache.
@@ -134,8 +144,10 @@ func New(n int) Buffers {
 // clients.  Those buffers are intended to be used strictly internally, within
 // the methods of some "object".
 //
-// NOTE: Alloc will panic if there are no buffers (buffer slots) left.
+// NOTE: Alloc will panic if there are no buffers (buffer slots) left or if n
+// is negative, see ErrInvalidSize.
 func (p *Buffers) Alloc(n int) (r []byte) {
+	checkSize("Buffers.Alloc", n)
 	b := *p
 	if len(b) == 0 {
 		panic(errors.New("Buffers.Alloc: out of buffers"))
@@ -208,8 +220,953 @@ func (p *Buffers) Stats() (bytes int) {
 	return
 }
 
+// Stack type represents a buffer ([]byte) cache. It's Buffers extended by
+// Options, replacement policies, debug modes and statistics.
+//
+// NOTE: Do not modify Stack directly, use only its methods. Do not create
+// additional values (copies) of Stack, that'll break its functionality. Use
+// a pointer instead to refer to a single instance from different
+// places/scopes.
+type Stack struct {
+	// s[:len(s)] are the free slots, s[len(s):cap(s)] are the allocated
+	// ones, the most recently allocated one at s[len(s)].
+	s           []slot
+	tick        uint64
+	policy      Policy
+	softLimit   int
+	onEvict     func(evicted int)
+	grows       uint64
+	peak        int
+	ttl         time.Duration
+	clock       Clock
+	esc         *escapes
+	trace       bool
+	checked     bool
+	labels      *pprof.LabelSet
+	caps        []int // Maximum retained capacity per nesting level, see NewWithSlotCaps.
+	shrinking   bool  // A Shrink waits for allocated slots to be freed.
+	frozen      bool  // See Freeze.
+	zero        ZeroAlloc
+	ops         *opLog               // See the PanicState option.
+	transitions map[SlotState]uint64 // Debug modes only, see Transitions.
+	large       int                  // See the LargeThreshold option.
+	transN      uint64               // Number of buffers dropped by Free, see TransientStats.
+	transB      uint64               // Combined capacity of the buffers dropped by Free.
+	slots       int                  // Target number of slots of a pending Shrink.
+	bytes       int64                // Combined capacity of the slot buffers, see Stats.
+	budget      int                  // See the Budget option.
+	onPressure  func(need int)
+	backing     Allocator // See the Backing option.
+	owned       bool      // See the CheckOwner option.
+	strict      bool      // See the StrictOrder option.
+	ownerID     uint64    // ID of the owning goroutine, zero if not yet known.
+	verbosity   PanicVerbosity
+	hwm         int     // Biggest request since the last TrimToFit.
+	failN       int     // See the FailEveryN option.
+	allocs      int     // Allocations counted for FailEveryN.
+	ewma        float64 // See the SizeEWMA option.
+	poison      bool    // See the PoisonTail option.
+	minAlign    int     // See the MinAlignment option.
+	touch       bool    // See the TouchPages option.
+}
+
+type slot struct {
+	b     []byte
+	used  uint64     // Stack.tick of the last Alloc.
+	idle  time.Time  // Time of the last Free, maintained only if ttl > 0.
+	dbg   *slotDebug // Non nil only in debug modes.
+	rgn   *trace.Region
+	ver   uint64          // AllocInit version of the content, zero if none.
+	align int             // Alignment of the start of b.
+	pin   *runtime.Pinner // Non nil if b is pinned by AllocPinned.
+	keep  *slot           // The retained slot while b is a large allocation.
+	gone  SlotState       // The state of a free slot without a buffer.
+	sum   uint32          // Checked mode only: checksum of b at Free.
+	site  string          // Checked mode only: call site of Free, empty if sum is not valid.
+
+	allocSite string    // StrictOrder mode only: call site of the allocation.
+	note      any       // See SetNote.
+	label     string    // See AllocLabeled.
+	stack     []uintptr // PanicStacks verbosity only: call stack of the allocation.
+
+	borrows int // Outstanding Borrows, maintained in checked mode.
+	vlen    int // AllocInit length of the content.
+	size    int // Requested length of the allocation.
+	tail    int // PoisonTail only: offset of the poisoned tail of b.
+
+	avg float64 // SizeEWMA only: moving average of the request sizes.
+}
+
+// checkSize panics with ErrInvalidSize if n, the size requested by op, is
+// negative.
+func checkSize(op string, n int) {
+	if n < 0 {
+		panic(fmt.Errorf("%s: size %d: %w", op, n, ErrInvalidSize))
+	}
+}
+
+// ZeroAlloc selects the handling of Alloc(0), see the ZeroAlloc option.
+type ZeroAlloc int
+
+// Values of ZeroAlloc.
+const (
+	// ZeroAllocSlot makes Alloc(0) consume a slot, as any other Alloc, and
+	// return a zero length slice of the buffer retained by the slot. This
+	// is the default.
+	ZeroAllocSlot ZeroAlloc = iota
+
+	// ZeroAllocEmpty makes Alloc(0) return an empty slice with no
+	// capacity without consuming a slot. Free must not be called for it.
+	ZeroAllocEmpty
+
+	// ZeroAllocPanic makes Alloc(0) panic.
+	ZeroAllocPanic
+)
+
+// NewStack returns a newly created instance of Stack with a maximum capacity
+// of n buffers.
+func NewStack(n int) Stack {
+	return Stack{s: make([]slot, n)}
+}
+
+// NewWithSlotCaps returns a newly created instance of Stack with a maximum
+// capacity of len(caps) buffers. A buffer freed at nesting level i, ie. when
+// Depth() == i+1, is retained only if its capacity does not exceed caps[i].
+// Otherwise it's dropped and left to the garbage collector. A negative
+// caps[i] means no limit.
+//
+// Use NewWithSlotCaps when the buffer sizes differ by the nesting level, for
+// example small buffers at the first level and big ones at the second.
+func NewWithSlotCaps(caps []int) Stack {
+	b := NewStack(len(caps))
+	b.caps = append([]int(nil), caps...)
+	return b
+}
+
+// Alloc will return a buffer such that len(r) == n. It will firstly try to
+// find an existing and unused buffer of big enough size. Only when there is no
+// such, then one of the buffer slots is reallocated to a bigger size. The slot
+// to reallocate is selected by the replacement policy, see SetPolicy.
+//
+// It's okay to use append with buffers returned by Alloc. But it can cause
+// allocation in that case and will again be producing load for the garbage
+// collector. The best use of Alloc is for I/O buffers where the needed size of
+// the buffer is figured out at some point of the code path in a 'final size'
+// sense. Another real world example are compression/decompression buffers.
+//
+// NOTE: The buffer returned by Alloc _is not_ zeroed. That's okay for e.g.
+// passing a buffer to io.Reader. If you need a zeroed buffer use Calloc.
+//
+// NOTE: Buffers returned from Alloc _must not_ be exposed/returned to your
+// clients.  Those buffers are intended to be used strictly internally, within
+// the methods of some "object".
+//
+// NOTE: Alloc will panic if there are no buffers (buffer slots) left or if n
+// is negative, see ErrInvalidSize.
+func (p *Stack) Alloc(n int) (r []byte) {
+	align := max(p.minAlign, 1)
+	if r, done := p.prologue("Alloc", n, align); done {
+		return r
+	}
+
+	i, ok := p.pick(n, align)
+	return p.alloc(i, n, align, ok)
+}
+
+// prologue performs the checks and handles the special cases common to all
+// methods allocating a buffer of length n aligned to align. op is the name of
+// the method. If done is set, r is the allocated buffer and the caller must
+// return it.
+func (p *Stack) prologue(op string, n, align int) (r []byte, done bool) {
+	checkSize("Stack."+op, n)
+	if p.owned {
+		p.checkOwner(op)
+	}
+	if len(p.s) == 0 || p.failN > 0 && p.inject() {
+		p.fail(p.exhausted("Stack." + op))
+	}
+
+	if n == 0 && p.zero != ZeroAllocSlot {
+		if p.zero == ZeroAllocPanic {
+			panic(fmt.Errorf("Stack.%s: size 0: %w", op, ErrInvalidSize))
+		}
+
+		return []byte{}, true
+	}
+
+	if p.large > 0 && n > p.large && p.esc == nil {
+		return p.allocLarge(n, align), true
+	}
+
+	return nil, false
+}
+
+// allocLarge allocates a buffer of length n, aligned to align, above the
+// LargeThreshold option. It uses the free slot retaining the smallest buffer,
+// which is kept aside until Free.
+func (p *Stack) allocLarge(n, align int) []byte {
+	i := len(p.s) - 1
+	for j, v := range p.s[:i] {
+		if cap(v.b) < cap(p.s[i].b) {
+			p.s[i], p.s[j] = p.s[j], p.s[i]
+		}
+	}
+	p.checkFrozen("Alloc", n)
+	p.checkBudget("Alloc", n, &p.s[i])
+	keep := p.s[i]
+	p.tick++
+	if p.ops != nil {
+		p.ops.alloc(n)
+	}
+	size := n
+	if align > 1 {
+		size += align - 1
+	}
+	r := p.makeBuf(size, size, size)
+	p.bytes += int64(cap(r) - cap(keep.b))
+	p.s[i] = slot{b: r, used: p.tick, align: alignOf(r), keep: &keep, size: n}
+	if align > 1 {
+		off := p.s[i].padding(align)
+		r = r[off : off+n]
+	}
+	p.s = p.s[:i]
+	p.peak = max(p.peak, p.Depth())
+	if p.trace {
+		p.traceAlloc(&p.s[:i+1][i], n)
+	}
+	if p.strict {
+		p.s[:i+1][i].allocSite = allocSite()
+	}
+	if p.verbosity == PanicStacks {
+		p.s[:i+1][i].stack = callers()
+	}
+	if p.poison {
+		s := &p.s[:i+1][i]
+		s.tail = 0
+		s.reserve(r)
+	}
+	p.enter(SlotInUse)
+	return r
+}
+
+// alloc allocates the free slot i for a buffer of length n aligned to align.
+// If !ok, the slot buffer is reallocated first.
+func (p *Stack) alloc(i, n, align int, ok bool) (r []byte) {
+	b := p.s
+	if p.checked {
+		p.verify(&b[i])
+	}
+	p.tick++
+	if p.ops != nil {
+		p.ops.alloc(n)
+	}
+	if !ok || p.esc != nil {
+		size := n
+		if align > 1 {
+			size += align - 1
+		}
+		p.checkFrozen("Alloc", size)
+		p.checkBudget("Alloc", overCommit(size), &b[i])
+		var dbg *slotDebug
+		switch {
+		case p.esc != nil:
+			r, dbg = p.esc.alloc(size)
+		default:
+			r = p.makeBuf(size, size, overCommit(size))
+		}
+		p.bytes += int64(cap(r) - cap(b[i].b))
+		p.release(b[i].b)
+		b[i] = slot{b: r, dbg: dbg, align: alignOf(r), avg: b[i].avg}
+	}
+	b[i].used = p.tick
+	b[i].ver = 0
+	b[i].size = n
+	p.hwm = max(p.hwm, n+align-1)
+	if p.ewma > 0 {
+		switch v := &b[i]; {
+		case v.avg == 0:
+			v.avg = float64(n)
+		default:
+			v.avg += p.ewma * (float64(n) - v.avg)
+		}
+	}
+	off := b[i].padding(align)
+	r = b[i].b[off : off+n]
+	last := len(b) - 1
+	b[last], b[i] = b[i], b[last]
+	p.s = b[:last]
+	if d := p.Depth(); d > p.peak {
+		p.peak = d
+	}
+	if !ok {
+		p.enforceSoftLimit()
+	}
+	if p.trace {
+		p.traceAlloc(&b[last], n)
+	}
+	if p.strict {
+		b[last].allocSite = allocSite()
+	}
+	if p.verbosity == PanicStacks {
+		b[last].stack = callers()
+	}
+	if p.poison {
+		b[last].tail = 0
+		b[last].reserve(r)
+	}
+	p.enter(SlotInUse)
+	return r
+}
+
+// AllocInit is like Alloc, but the buffer is initialized by init. Stack
+// remembers the version of the content initialized by init and when a free
+// buffer with the same version and length n exists, it's returned without
+// calling init again. Version zero is reserved and panics. Buffers returned
+// by Alloc and Calloc are assumed to have their content changed.
+//
+// AllocInit is useful for scratch buffers holding precomputed data like
+// lookup tables. Bump the version whenever the data must be recomputed.
+//
+// NOTE: Modifying the content of a buffer returned by AllocInit invalidates
+// it for later reuse by AllocInit with the same version.
+func (p *Stack) AllocInit(n int, version uint64, init func(b []byte)) []byte {
+	if version == 0 {
+		panic(errors.New("Stack.AllocInit: invalid version"))
+	}
+
+	align := max(p.minAlign, 1)
+	if r, done := p.prologue("AllocInit", n, align); done {
+		init(r)
+		return r
+	}
+
+	for i, v := range p.s {
+		if v.ver == version && v.vlen == n && v.avail(align) >= n {
+			r := p.alloc(i, n, align, true)
+			p.top().ver, p.top().vlen = version, n
+			return r
+		}
+	}
+
+	i, ok := p.pick(n, align)
+	r := p.alloc(i, n, align, ok)
+	init(r)
+	p.top().ver, p.top().vlen = version, n
+	return r
+}
+
+// pick returns the index of the free slot to be used for a buffer of length n
+// aligned to align and whether its buffer is big enough to be reused as is.
+func (p *Stack) pick(n, align int) (int, bool) {
+	b := p.s
+	if p.policy == ClosestFit {
+		closest, closestI := -1, -1
+		for i, v := range b {
+			d := v.avail(align) - n
+			if d < 0 {
+				d = -d
+			}
+			if closestI < 0 || d < closest {
+				closest, closestI = d, i
+				if d == 0 {
+					break
+				}
+			}
+		}
+		return closestI, b[closestI].avail(align) >= n
+	}
+
+	biggest, best, biggestI, bestI := -1, -1, -1, -1
+	for i, v := range b {
+		//ln := len(v)
+		// The above was correct, buts it's just confusing. It worked
+		// because not the buffers, but slices of them are returned in
+		// the 'if best >= n' code path.
+		ln := v.avail(align)
+
+		if ln >= biggest {
+			biggest, biggestI = ln, i
+		}
+
+		if ln >= n && (bestI < 0 || best > ln) {
+			best, bestI = ln, i
+			if ln == n {
+				break
+			}
+		}
+	}
+	if bestI >= 0 {
+		return bestI, true
+	}
+
+	if p.policy == LRU {
+		lru := 0
+		for i, v := range b {
+			if v.used < b[lru].used {
+				lru = i
+			}
+		}
+		return lru, false
+	}
+
+	return biggestI, false
+}
+
+// AllocCap is like Alloc, but the capacity of the result is at least
+// capHint. A caller which will append a bounded amount of data to the buffer
+// reserves the capacity up front and the appends then stay inside the
+// retained buffer instead of reallocating it outside of Stack.
+func (p *Stack) AllocCap(n, capHint int) []byte {
+	checkSize("Stack.AllocCap", n)
+	if capHint <= n {
+		return p.Alloc(n)
+	}
+
+	r := p.Alloc(capHint)
+	p.top().size = n
+	return r[:n]
+}
+
+// Calloc will acquire a buffer using Alloc and then clears it to zeros. The
+// zeroing goes up to n, not cap(r).
+func (p *Stack) Calloc(n int) (r []byte) {
+	r = p.Alloc(n)
+	for i := range r {
+		r[i] = 0
+	}
+	return
+}
+
+// CallocN is like Calloc, but only the first zeroPrefix bytes of the buffer
+// are cleared. It's useful when only a header must be zeroed while the rest
+// of the buffer is going to be overwritten anyway, for example by a Read.
+func (p *Stack) CallocN(n, zeroPrefix int) (r []byte) {
+	r = p.Alloc(n)
+	z := r[:min(max(zeroPrefix, 0), n)]
+	for i := range z {
+		z[i] = 0
+	}
+	return
+}
+
+// Fill will acquire a buffer using Alloc and then sets all its bytes, up to n,
+// to v.
+func (p *Stack) Fill(n int, v byte) (r []byte) {
+	r = p.Alloc(n)
+	if n != 0 {
+		r[0] = v
+		fill(r, 1)
+	}
+	return
+}
+
+// FillPattern will acquire a buffer using Alloc and then fills it, up to n,
+// with repetitions of pattern, the last one possibly truncated. An empty
+// pattern leaves the buffer as returned by Alloc.
+func (p *Stack) FillPattern(n int, pattern []byte) (r []byte) {
+	r = p.Alloc(n)
+	if len(pattern) != 0 {
+		fill(r, copy(r, pattern))
+	}
+	return
+}
+
+// fill repeats b[:k] over the rest of b, doubling the size of each copy.
+func fill(b []byte, k int) {
+	for k < len(b) {
+		k += copy(b[k:], b[:k])
+	}
+}
+
+// ForEachChunk calls fn for consecutive chunks of a job of total bytes,
+// passing it a buffer of length chunkSize, or shorter for the tail chunk. All
+// calls share a single buffer obtained by Alloc, which is freed before
+// ForEachChunk returns, including when fn fails or panics. ForEachChunk stops
+// at the first error returned by fn and returns it.
+//
+// NOTE: The chunks _are not_ zeroed.
+func (p *Stack) ForEachChunk(total, chunkSize int, fn func(chunk []byte) error) error {
+	checkSize("Stack.ForEachChunk", total)
+	if chunkSize <= 0 {
+		panic(fmt.Errorf("Stack.ForEachChunk: chunk size %d: %w", chunkSize, ErrInvalidSize))
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	b := p.Alloc(min(chunkSize, total))
+	defer p.Free()
+
+	for total > 0 {
+		n := min(len(b), total)
+		if err := fn(b[:n]); err != nil {
+			return err
+		}
+
+		total -= n
+	}
+	return nil
+}
+
+// Append appends src to dst and returns the updated slice, like the built-in
+// append does. dst must be the buffer returned by the lastly made and not yet
+// freed Alloc, possibly resliced or returned by a previous Append or Grow. If
+// the buffer has not enough capacity, Append reallocates the slot to a bigger
+// buffer which is then retained instead of the old one. Such reallocations are
+// counted, see Grows.
+func (p *Stack) Append(dst []byte, src ...byte) []byte {
+	return append(p.grow("Append", dst, len(src)), src...)
+}
+
+// Grow returns buf with its capacity increased, if necessary, to guarantee
+// space for another n bytes. buf must be the buffer returned by the lastly
+// made and not yet freed Alloc, possibly resliced or returned by a previous
+// Append or Grow. The growth happens inside Stack: the slot is reallocated
+// to the bigger buffer, which is then retained for later reuse instead of
+// the old one. The built-in append, in contrast, leaves the slot with the old
+// buffer.
+func (p *Stack) Grow(buf []byte, n int) []byte { return p.grow("Grow", buf, n) }
+
+func (p *Stack) grow(op string, buf []byte, n int) []byte {
+	if p.owned {
+		p.checkOwner(op)
+	}
+	if len(buf)+n <= cap(buf) {
+		if p.poison {
+			p.top().reserve(buf[:len(buf)+n])
+		}
+		return buf
+	}
+
+	top := p.top()
+	if cap(buf) != 0 && (cap(top.b) == 0 || &buf[:1][0] != &top.b[:1][0]) {
+		p.fail(fmt.Errorf("Stack.%s: not the last allocated buffer", op))
+	}
+
+	p.checkFrozen(op, len(buf)+n)
+	p.checkBudget(op, overCommit(len(buf)+n), top)
+	var r []byte
+	switch {
+	case p.esc != nil:
+		// The finalizer armed by retire needs the start of a Go allocation.
+		r, _ = p.esc.alloc(len(buf) + n)
+		r = r[:len(buf)]
+	default:
+		r = p.makeBuf(len(buf), len(buf)+n, overCommit(len(buf)+n))
+	}
+	copy(r, buf)
+	p.bytes += int64(cap(r) - cap(top.b))
+	p.release(top.b)
+	top.b = r
+	if p.poison {
+		top.tail = 0
+		top.reserve(r[:len(buf)+n])
+	}
+	p.grows++
+	p.enforceSoftLimit()
+	return r
+}
+
+// Grows returns the number of slot reallocations made by Append and Grow.
+func (p *Stack) Grows() uint64 { return p.grows }
+
+// top returns the slot of the lastly made and not yet freed Alloc.
+func (p *Stack) top() *slot {
+	if len(p.s) == cap(p.s) {
+		panic(errors.New("Stack: no buffer allocated"))
+	}
+
+	return &p.s[:len(p.s)+1][len(p.s)]
+}
+
+// Free makes the lastly allocated by Alloc buffer free (available) again for
+// Alloc.
+//
+// NOTE: Improper Free invocations, like in the sequence {New, Alloc, Free,
+// Free}, will panic.
+func (p *Stack) Free() {
+	if p.owned {
+		p.checkOwner("Free")
+	}
+	if len(p.s) == cap(p.s) {
+		p.fail(fmt.Errorf("Stack.Free: %w", ErrDoubleFree))
+	}
+
+	if p.ops != nil {
+		p.ops.free(cap(p.top().b))
+	}
+
+	if p.checked {
+		p.check(p.top())
+	}
+	if p.poison {
+		p.poisoned(p.top())
+	}
+	p.top().unpin()
+	p.top().note = nil
+	p.top().label = ""
+	level := p.Depth() - 1
+	p.s = p.s[:len(p.s)+1]
+	if p.trace {
+		p.traceFree(&p.s[len(p.s)-1])
+	}
+	switch s := &p.s[len(p.s)-1]; {
+	case s.keep != nil:
+		p.transient(cap(s.b))
+		p.bytes += int64(cap(s.keep.b) - cap(s.b))
+		p.release(s.b)
+		*s = *s.keep
+		p.enter(SlotFree)
+	case level < len(p.caps) && p.caps[level] >= 0 && cap(s.b) > p.caps[level]:
+		p.transient(cap(s.b))
+		p.drop(s, SlotTrimmed)
+	case p.esc != nil:
+		p.transient(cap(s.b))
+		p.esc.retire(s)
+		p.drop(s, SlotPoisoned)
+	default:
+		if p.checked && cap(s.b) != 0 {
+			s.sum, s.site = checksum(s.b), callSite(2)
+		}
+		p.enter(SlotFree)
+	}
+	if p.ttl > 0 {
+		now := p.clock.Now()
+		p.s[len(p.s)-1].idle = now
+		p.trim(now)
+	}
+	if p.shrinking {
+		p.dropFree(1)
+	}
+}
+
+// Trim drops the free buffers which were not used for longer than the TTL
+// option of Stack and right-sizes the free buffers as selected by the
+// SizeEWMA option. Free does the same if TTL is set, but Trim can be used to
+// release memory of Stack not being used at all. Trim is a no-op if neither
+// TTL nor SizeEWMA is set.
+func (p *Stack) Trim() {
+	switch {
+	case p.ttl > 0:
+		p.trim(p.clock.Now())
+	case p.ewma > 0:
+		p.rightSize()
+	}
+}
+
+// TrimToFit reallocates the free buffers bigger than needed by the biggest
+// request since the previous TrimToFit, the high-water mark, to the size
+// Alloc would allocate for the high-water mark. Buffers having served no
+// request since then are dropped. Nothing is copied as the buffers are free.
+// TrimToFit reclaims the memory retained after a temporary spike of request
+// sizes without dropping all buffers. Pinned buffers are kept. TrimToFit
+// returns the number of bytes released.
+func (p *Stack) TrimToFit() (bytes int64) {
+	hwm := p.hwm
+	p.hwm = 0
+	if p.esc != nil {
+		return 0
+	}
+
+	bytes = p.bytes
+	c := overCommit(hwm)
+	for i := range p.s {
+		v := &p.s[i]
+		switch {
+		case v.b == nil || v.pin != nil || cap(v.b) <= c:
+			// nop
+		case hwm == 0:
+			p.drop(v, SlotTrimmed)
+		case !p.frozen:
+			p.refit(v, hwm)
+		}
+	}
+	return bytes - p.bytes
+}
+
+func (p *Stack) trim(now time.Time) {
+	for i, v := range p.s {
+		if v.b != nil && now.Sub(v.idle) > p.ttl {
+			p.drop(&p.s[i], SlotTrimmed)
+		}
+	}
+	if p.ewma > 0 {
+		p.rightSize()
+	}
+}
+
+// rightSize reallocates the free buffers more than twice as big as needed for
+// the moving average of their request sizes, see the SizeEWMA option.
+func (p *Stack) rightSize() {
+	if p.esc != nil || p.frozen {
+		return
+	}
+
+	for i := range p.s {
+		v := &p.s[i]
+		if v.b == nil || v.pin != nil || v.avg == 0 {
+			continue
+		}
+
+		if n := int(math.Ceil(v.avg)); cap(v.b) > 2*overCommit(n) {
+			p.refit(v, n)
+		}
+	}
+}
+
+// refit reallocates the buffer of the free slot v to the size Alloc(n) would
+// allocate.
+func (p *Stack) refit(v *slot, n int) {
+	b := p.makeBuf(n, n, overCommit(n))
+	p.bytes += int64(cap(b) - cap(v.b))
+	p.release(v.b)
+	*v = slot{b: b, used: v.used, idle: v.idle, align: alignOf(b), avg: v.avg}
+}
+
+// Depth returns the number of buffers allocated by Alloc and not yet freed.
+func (p *Stack) Depth() int { return cap(p.s) - len(p.s) }
+
+// Remaining returns the number of buffers which can be allocated before Alloc
+// panics. Recursive code can use it to switch to a non pooled fallback in
+// time.
+func (p *Stack) Remaining() int { return len(p.s) }
+
+// Clone returns a new Stack with the same number of slots, options and
+// policies as p, but with empty slots and fresh statistics. A pending Shrink
+// is applied to the slot count of the clone. Freeze is not inherited.
+func (p *Stack) Clone() Stack {
+	n := cap(p.s)
+	if p.shrinking {
+		n = p.slots
+	}
+	q := Stack{
+		s:          make([]slot, n),
+		policy:     p.policy,
+		softLimit:  p.softLimit,
+		onEvict:    p.onEvict,
+		ttl:        p.ttl,
+		clock:      p.clock,
+		trace:      p.trace,
+		checked:    p.checked,
+		labels:     p.labels,
+		caps:       p.caps,
+		zero:       p.zero,
+		large:      p.large,
+		budget:     p.budget,
+		onPressure: p.onPressure,
+		owned:      p.owned,
+		backing:    p.backing,
+		strict:     p.strict,
+		verbosity:  p.verbosity,
+		failN:      p.failN,
+		ewma:       p.ewma,
+		poison:     p.poison,
+		minAlign:   p.minAlign,
+		touch:      p.touch,
+	}
+	if p.esc != nil {
+		q.esc = newEscapes()
+	}
+	if p.transitions != nil {
+		q.transitions = map[SlotState]uint64{}
+	}
+	if p.ops != nil {
+		q.ops = &opLog{}
+	}
+	return q
+}
+
+// Shrink reduces the number of buffer slots to newSlots, dropping the free
+// slots holding the smallest buffers first. If more than newSlots buffers are
+// currently allocated, the remaining slots are dropped by Free as the buffers
+// are freed.
+func (p *Stack) Shrink(newSlots int) {
+	newSlots = max(newSlots, 0)
+	if newSlots >= cap(p.s) {
+		return
+	}
+
+	p.dropFree(min(cap(p.s)-newSlots, len(p.s)))
+	if p.shrinking = cap(p.s) > newSlots; p.shrinking {
+		p.slots = newSlots
+	}
+}
+
+// GrowSlots increases the number of buffer slots to newSlots. The new slots
+// are free and hold no buffers. If a Shrink is pending, GrowSlots makes it
+// stop at newSlots.
+//
+// GrowSlots is not named Grow because that's the method growing an allocated
+// buffer.
+func (p *Stack) GrowSlots(newSlots int) {
+	if p.shrinking {
+		if newSlots >= cap(p.s) {
+			p.shrinking = false
+		}
+		p.slots = max(p.slots, newSlots)
+	}
+	if newSlots <= cap(p.s) {
+		return
+	}
+
+	n := newSlots - cap(p.s)
+	s := make([]slot, newSlots)
+	copy(s[n:], p.s[:cap(p.s)])
+	p.s = s[:len(p.s)+n]
+}
+
+// dropFree removes k free slots holding the smallest buffers.
+func (p *Stack) dropFree(k int) {
+	if k <= 0 {
+		return
+	}
+
+	free := p.s[:len(p.s)]
+	sort.Slice(free, func(i, j int) bool { return cap(free[i].b) < cap(free[j].b) })
+	for _, v := range free[:k] {
+		p.bytes -= int64(cap(v.b))
+		p.release(v.b)
+	}
+	clear(free[:k])
+	p.s = p.s[k:]
+	if p.shrinking && cap(p.s) <= p.slots {
+		p.shrinking = false
+	}
+}
+
+// Freeze makes any subsequent allocation of a new backing array, by Alloc,
+// Append, Grow or any other method, panic with an error satisfying
+// errors.Is(err, ErrFrozen). Use it after a warm-up to guarantee the steady
+// state of a program does not allocate buffers. Unfreeze reverts the effect.
+func (p *Stack) Freeze() { p.frozen = true }
+
+// Unfreeze reverts the effect of Freeze.
+func (p *Stack) Unfreeze() { p.frozen = false }
+
+// checkFrozen panics if p is frozen. op is the public method allocating size
+// bytes.
+func (p *Stack) checkFrozen(op string, size int) {
+	if p.frozen {
+		p.fail(fmt.Errorf("Stack.%s: allocating %d bytes: %w", op, size, ErrFrozen))
+	}
+}
+
+// transient records a buffer of capacity c dropped by Free.
+func (p *Stack) transient(c int) {
+	p.transN++
+	p.transB += uint64(c)
+}
+
+// TransientStats reports the number and combined capacity of the buffers
+// which were not retained by Free, because of the LargeThreshold option, the
+// slot caps set by NewWithSlotCaps or the DetectEscapes mode. Such allocations
+// are not absorbed by the Stack and are not included in Stats.
+func (p *Stack) TransientStats() (n, bytes uint64) { return p.transN, p.transB }
+
+// Peak returns the maximum Depth reached so far.
+func (p *Stack) Peak() int { return p.peak }
+
+// Verify checks the Alloc/Free calls made so far against maxDepth, the
+// maximum nesting depth declared by the user of Stack. It returns an error
+// if any buffer is still allocated, if the nesting depth exceeded maxDepth or
+// if Stack has less than maxDepth slots. Verify is intended for tests
+// exercising the code paths using Stack, to catch depth bugs before the
+// panic of Alloc does.
+func (p *Stack) Verify(maxDepth int) error {
+	switch {
+	case p.Depth() != 0:
+		if notes := p.notes(); notes != "" {
+			return fmt.Errorf("Stack: %d buffer(s) not freed, notes: %s", p.Depth(), notes)
+		}
+
+		return fmt.Errorf("Stack: %d buffer(s) not freed", p.Depth())
+	case p.peak > maxDepth:
+		return fmt.Errorf("Stack: depth %d exceeds the declared maximum %d", p.peak, maxDepth)
+	case cap(p.s) < maxDepth:
+		return fmt.Errorf("Stack: %d slot(s) cannot serve the declared maximum depth %d", cap(p.s), maxDepth)
+	}
+	return nil
+}
+
+// Stats reports memory consumed by Stack, without accounting for some
+// (smallish) additional overhead. The statistics are maintained
+// incrementally, Stats takes constant time.
+func (p *Stack) Stats() (bytes int64) { return p.bytes }
+
+// Policy selects which free slot of Stack is reallocated by Alloc when no
+// free buffer is big enough to be reused.
+type Policy int
+
+// Values of Policy.
+const (
+	// Largest reallocates the biggest free buffer. This is the default.
+	Largest Policy = iota
+
+	// LRU reallocates the least recently used free buffer.
+	LRU
+
+	// ClosestFit uses the free buffer with capacity closest to the
+	// requested size, reallocating it if it's too small. Unlike the other
+	// policies it may prefer reallocating a small buffer over reusing a
+	// much bigger one, keeping the big one available for big requests.
+	ClosestFit
+)
+
+// SetPolicy sets the slot replacement policy of Stack.
+func (p *Stack) SetPolicy(policy Policy) { p.policy = policy }
+
+// SetSoftLimit sets a soft limit of the memory retained by Stack. Whenever
+// Alloc makes the retained memory, as reported by Stats, exceed bytes, the
+// least recently used free buffers are dropped until the limit is met again
+// or no free buffers are left. If onEvict is not nil, it's called with the
+// number of bytes dropped.
+//
+// Buffers currently allocated are never dropped, so the limit can be exceeded
+// while they are in use. A limit <= 0 disables the soft limit, which is the
+// default.
+func (p *Stack) SetSoftLimit(bytes int, onEvict func(evicted int)) {
+	p.softLimit, p.onEvict = bytes, onEvict
+	p.enforceSoftLimit()
+}
+
+func (p *Stack) enforceSoftLimit() {
+	if p.softLimit <= 0 {
+		return
+	}
+
+	retained := p.Stats()
+	evicted := 0
+	for retained > int64(p.softLimit) {
+		lru := -1
+		for i, v := range p.s {
+			if v.b != nil && (lru < 0 || v.used < p.s[lru].used) {
+				lru = i
+			}
+		}
+		if lru < 0 {
+			break
+		}
+
+		n := cap(p.s[lru].b)
+		p.drop(&p.s[lru], SlotTrimmed)
+		retained -= int64(n)
+		evicted += n
+	}
+	if evicted != 0 && p.onEvict != nil {
+		p.onEvict(evicted)
+	}
+}
+
 // Cache caches buffers ([]byte). A zero value of Cache is ready for use.
 //
+// Zero length requests and zero capacity buffers are handled the same way by
+// all caches of this package: Get(0), Cget(0) and TryGet(0) return an empty,
+// non nil slice of zero capacity, succeed without allocating and leave the
+// cache unchanged. Put of a zero capacity buffer, including nil, does
+// nothing. Put of a zero length buffer of nonzero capacity caches it, Put
+// always considers the full capacity of a buffer.
+//
 // NOTE: Do not modify a Cache directly, use only its methods. Do not create
 // additional values (copies) of a Cache, that'll break its functionality. Use
 // a pointer instead to refer to a single instance from different
@@ -241,11 +1198,18 @@ type Cache [][]byte
 // okay for e.g.  passing a buffer to io.Reader. If you need a zeroed buffer
 // use Cget.
 func (c *Cache) Get(n int) []byte {
-	r, _ := c.get(n)
+	checkSize("Cache.Get", n)
+	if n == 0 {
+		return []byte{}
+	}
+
+	r, _, _ := c.get(n)
 	return r
 }
 
-func (c *Cache) get(n int) (r []byte, isZeroed bool) {
+// get is Get, reporting also whether r is zeroed and the capacity of the
+// cached buffer removed from c, if any.
+func (c *Cache) get(n int) (r []byte, isZeroed bool, removed int) {
 	s := *c
 	lens := len(s)
 	if lens == 0 {
@@ -254,22 +1218,28 @@ func (c *Cache) get(n int) (r []byte, isZeroed bool) {
 	}
 
 	i := sort.Search(lens, func(x int) bool { return len(s[x]) >= n })
+	removed = cap(s[min(i, lens-1)])
 	if i == lens {
 		i--
-		s[i] = make([]byte, n, overCommit(n))
+		s[i], isZeroed = make([]byte, n, overCommit(n)), true
 	}
 	r = s[i][:n]
 	copy(s[i:], s[i+1:])
 	s[lens-1] = nil
 	s = s[:lens-1]
 	*c = s
-	return r, false
+	return r, isZeroed, removed
 }
 
 // Cget will acquire a buffer using Get and then clears it to zeros. The
 // zeroing goes up to n, not cap(r).
 func (c *Cache) Cget(n int) (r []byte) {
-	r, ok := c.get(n)
+	checkSize("Cache.Cget", n)
+	if n == 0 {
+		return []byte{}
+	}
+
+	r, ok, _ := c.get(n)
 	if ok {
 		return
 	}
@@ -280,6 +1250,31 @@ func (c *Cache) Cget(n int) (r []byte) {
 	return
 }
 
+// TryGet is like Get, but it only returns a cached buffer of sufficient size.
+// If there's none, TryGet reports false and leaves the cache unchanged.
+func (c *Cache) TryGet(n int) ([]byte, bool) {
+	checkSize("Cache.TryGet", n)
+	if n == 0 {
+		return []byte{}, true
+	}
+
+	r, ok, _ := c.tryGet(n)
+	return r, ok
+}
+
+// tryGet is TryGet, reporting also the capacity of the cached buffer removed
+// from c.
+func (c *Cache) tryGet(n int) (r []byte, ok bool, removed int) {
+	s := *c
+	i := sort.Search(len(s), func(x int) bool { return len(s[x]) >= n })
+	if i == len(s) {
+		return nil, false, 0
+	}
+
+	r, _, removed = c.get(n)
+	return r, true, removed
+}
+
 // Put caches b for possible later reuse (via Get). No other references to b's
 // backing array may exist. Otherwise a big mess is sooner or later inevitable.
 func (c *Cache) Put(b []byte) {
@@ -301,19 +1296,30 @@ func (c *Cache) Put(b []byte) {
 
 // Stats reports memory consumed by a Cache, without accounting for some
 // (smallish) additional overhead. 'n' is the number of cached buffers, bytes
-// is their combined capacity.
+// is their combined capacity. Use Stats64 if bytes can exceed the range of
+// int.
 func (c Cache) Stats() (n, bytes int) {
+	n, b := c.Stats64()
+	return n, int(b)
+}
+
+// Stats64 is like Stats but it reports bytes as an int64, which does not
+// overflow on 32-bit platforms.
+func (c Cache) Stats64() (n int, bytes int64) {
 	n = len(c)
 	for _, v := range c {
-		bytes += cap(v)
+		bytes += int64(cap(v))
 	}
 	return
 }
 
 // CCache is a Cache which is safe for concurrent use by multiple goroutines.
+// See Cache for the handling of zero length requests and buffers.
 type CCache struct {
-	c  Cache
-	mu sync.Mutex
+	c     Cache
+	mu    sync.Mutex
+	n     int   // Number of cached buffers, maintained for Stats.
+	bytes int64 // Combined capacity of the cached buffers.
 }
 
 // Get returns a buffer ([]byte) of length n. If no such buffer is cached then
@@ -341,8 +1347,13 @@ type CCache struct {
 // okay for e.g.  passing a buffer to io.Reader. If you need a zeroed buffer
 // use Cget.
 func (c *CCache) Get(n int) []byte {
+	checkSize("CCache.Get", n)
+	if n == 0 {
+		return []byte{}
+	}
+
 	c.mu.Lock()
-	r, _ := c.c.get(n)
+	r, _ := c.get(n)
 	c.mu.Unlock()
 	return r
 }
@@ -350,26 +1361,88 @@ func (c *CCache) Get(n int) []byte {
 // Cget will acquire a buffer using Get and then clears it to zeros. The
 // zeroing goes up to n, not cap(r).
 func (c *CCache) Cget(n int) (r []byte) {
+	checkSize("CCache.Cget", n)
+	if n == 0 {
+		return []byte{}
+	}
+
 	c.mu.Lock()
-	r = c.c.Cget(n)
+	r, isZeroed := c.get(n)
 	c.mu.Unlock()
+	if !isZeroed {
+		clear(r)
+	}
 	return
 }
 
+// get is Cache.get maintaining the statistics. It must be called with c.mu
+// held.
+func (c *CCache) get(n int) (r []byte, isZeroed bool) {
+	r, isZeroed, removed := c.c.get(n)
+	c.removed(removed)
+	return r, isZeroed
+}
+
+// removed accounts for a removed cached buffer of capacity removed, if
+// positive. It must be called with c.mu held.
+func (c *CCache) removed(removed int) {
+	if removed > 0 {
+		c.n--
+		c.bytes -= int64(removed)
+	}
+}
+
+// TryGet is like Get, but it only returns a cached buffer of sufficient size.
+// If there's none, TryGet reports false and leaves the cache unchanged.
+func (c *CCache) TryGet(n int) (r []byte, ok bool) {
+	checkSize("CCache.TryGet", n)
+	if n == 0 {
+		return []byte{}, true
+	}
+
+	c.mu.Lock()
+	r, ok, removed := c.c.tryGet(n)
+	c.removed(removed)
+	c.mu.Unlock()
+	return r, ok
+}
+
 // Put caches b for possible later reuse (via Get). No other references to b's
 // backing array may exist. Otherwise a big mess is sooner or later inevitable.
 func (c *CCache) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
 	c.mu.Lock()
-	c.c.Put(b)
+	c.put(b)
 	c.mu.Unlock()
 }
 
+// put is Cache.Put maintaining the statistics. It must be called with c.mu
+// held.
+func (c *CCache) put(b []byte) {
+	c.c.Put(b)
+	if cap(b) != 0 {
+		c.n++
+		c.bytes += int64(cap(b))
+	}
+}
+
 // Stats reports memory consumed by a Cache, without accounting for some
 // (smallish) additional overhead. 'n' is the number of cached buffers, bytes
-// is their combined capacity.
+// is their combined capacity. The statistics are maintained incrementally,
+// Stats takes constant time. Use Stats64 if bytes can exceed the range of int.
 func (c *CCache) Stats() (n, bytes int) {
+	n, b := c.Stats64()
+	return n, int(b)
+}
+
+// Stats64 is like Stats but it reports bytes as an int64, which does not
+// overflow on 32-bit platforms.
+func (c *CCache) Stats64() (n int, bytes int64) {
 	c.mu.Lock()
-	n, bytes = c.c.Stats()
+	n, bytes = c.n, c.bytes
 	c.mu.Unlock()
 	return
 }
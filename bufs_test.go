@@ -5,10 +5,14 @@
 package bufs
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"path"
 	"runtime"
 	"testing"
+	"time"
 )
 
 var dbg = func(s string, va ...interface{}) {
@@ -76,6 +80,347 @@ func Test3(t *testing.T) {
 	t.Fatal("unexpected success")
 }
 
+func TestSoftLimit(t *testing.T) {
+	b := NewStack(3)
+	evicted := 0
+	b.SetSoftLimit(100, func(n int) { evicted += n })
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Alloc(30)
+	b.Free()
+	b.Free()
+	b.Free()
+	if g, e := b.Stats(), int64(120); g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Alloc(70) // Reallocates the 60 byte slot, the others get dropped.
+	if g, e := evicted, 60; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Stats(), int64(140); g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	b.SetSoftLimit(100, nil)
+	if g, e := b.Stats(), int64(0); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy Policy
+		stats  int
+	}{
+		{Largest, 20 + 200},
+		{LRU, 200 + 60},
+		{ClosestFit, 60 + 200},
+	} {
+		b := NewStack(2)
+		b.SetPolicy(test.policy)
+		b.Alloc(10)
+		b.Alloc(30)
+		b.Free()
+		b.Free()
+		b.Alloc(100)
+		b.Free()
+		b.Alloc(30)
+		b.Free()
+		if g, e := b.Stats(), int64(test.stats); g != e {
+			t.Error(test.policy, g, e)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	b := NewStack(2)
+	b.Alloc(100)
+	buf := b.Alloc(3)[:0] // cap 8
+	buf = b.Append(buf, []byte("1234")...)
+	buf = b.Append(buf, []byte("5678")...)
+	if g, e := b.Grows(), uint64(0); g != e {
+		t.Fatal(g, e)
+	}
+
+	buf = b.Append(buf, []byte("9")...)
+	if g, e := string(buf), "123456789"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Grows(), uint64(1); g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	if g, e := cap(b.Alloc(9)), cap(buf); g != e {
+		t.Fatal(g, e)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unexpected success")
+		}
+	}()
+
+	b.Append(make([]byte, 1), 1)
+}
+
+func TestDepth(t *testing.T) {
+	b := NewStack(3)
+	for i := 0; i < 3; i++ {
+		if g, e := b.Depth(), i; g != e {
+			t.Fatal(g, e)
+		}
+
+		if g, e := b.Remaining(), 3-i; g != e {
+			t.Fatal(g, e)
+		}
+
+		b.Alloc(i)
+	}
+	b.Free()
+	if g, e := b.Depth(), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Remaining(), 1; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	b := NewStack(3)
+	b.Alloc(1)
+	b.Alloc(1)
+	if b.Verify(3) == nil {
+		t.Fatal("unexpected success")
+	}
+
+	b.Free()
+	b.Free()
+	if err := b.Verify(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := b.Peak(), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if b.Verify(1) == nil {
+		t.Fatal("unexpected success")
+	}
+
+	if b.Verify(4) == nil {
+		t.Fatal("unexpected success")
+	}
+}
+
+func TestAllocInit(t *testing.T) {
+	b := NewStack(2)
+	inits := 0
+	init := func(b []byte) {
+		inits++
+		for i := range b {
+			b[i] = byte(i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		r := b.AllocInit(10, 1, init)
+		if g, e := r[9], byte(9); g != e {
+			t.Fatal(g, e)
+		}
+
+		b.Alloc(10)
+		b.Free()
+		b.Free()
+	}
+	if g, e := inits, 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.AllocInit(10, 2, init)
+	b.Free()
+	b.Alloc(10)
+	b.Alloc(10)
+	b.Free()
+	b.Free()
+	b.AllocInit(10, 2, init)
+	if g, e := inits, 3; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestCallocN(t *testing.T) {
+	b := NewStack(1)
+	r := b.Alloc(10)
+	for i := range r {
+		r[i] = 1
+	}
+	b.Free()
+	r = b.CallocN(10, 4)
+	if g, e := fmt.Sprint(r), "[0 0 0 0 1 1 1 1 1 1]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	if g, e := fmt.Sprint(b.CallocN(3, 4)), "[0 0 0]"; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestGrow(t *testing.T) {
+	b := NewStack(1)
+	buf := b.Alloc(4) // cap 8
+	copy(buf, "1234")
+	if g, e := cap(b.Grow(buf, 4)), 8; g != e {
+		t.Fatal(g, e)
+	}
+
+	buf = b.Grow(buf, 5)
+	if g, e := string(buf), "1234"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if cap(buf) < 9 || b.Grows() != 1 {
+		t.Fatal(cap(buf), b.Grows())
+	}
+
+	b.Free()
+	if g, e := b.Stats(), int64(cap(buf)); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestSlotCaps(t *testing.T) {
+	b := NewWithSlotCaps([]int{100, -1})
+	small := b.Alloc(1000)
+	big := b.Alloc(1000)
+	b.Free()
+	b.Free()
+	if g, e := b.Stats(), int64(cap(big)); g != e {
+		t.Fatal(g, e, cap(small))
+	}
+
+	if n, bytes := b.TransientStats(); n != 1 || bytes != uint64(cap(small)) {
+		t.Fatal(n, bytes)
+	}
+
+	b = NewWithSlotCaps([]int{100, -1})
+	small = b.Alloc(10)
+	b.Free()
+	if g, e := b.Stats(), int64(cap(small)); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestShrink(t *testing.T) {
+	b := NewStack(4)
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Alloc(30)
+	b.Free()
+	b.Shrink(1)
+	if g, e := b.Remaining(), 0; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Depth(), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	if g, e := b.Remaining(), 0; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	if g, e := b.Remaining(), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Stats(), int64(overCommit(10)); g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Alloc(5)
+	b.GrowSlots(3)
+	b.Alloc(6)
+	b.Alloc(7)
+	if g, e := b.Depth(), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	b.Free()
+	b.Free()
+	if g, e := b.Remaining(), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	c := NewWithOptions(1, &Options{Checked: true})
+	buf := c.Alloc(10)
+	_, release := c.Borrow(buf, 0, 1)
+	c.GrowSlots(2)
+	release()
+	c.Free()
+}
+
+func TestFill(t *testing.T) {
+	b := NewStack(3)
+	if g, e := b.Fill(5, 0xff), []byte{0xff, 0xff, 0xff, 0xff, 0xff}; !bytes.Equal(g, e) {
+		t.Fatal(g, e)
+	}
+
+	if g, e := string(b.FillPattern(8, []byte("abc"))), "abcabcab"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := string(b.FillPattern(2, []byte("abc"))), "ab"; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestLargeThreshold(t *testing.T) {
+	b := NewWithOptions(2, &Options{LargeThreshold: 100})
+	b.Alloc(50)
+	b.Free()
+	retained := b.Stats()
+	b.Alloc(1000)
+	b.Alloc(10) // Reuses the retained buffer.
+	b.Free()
+	b.Free()
+	if g, e := b.Stats(), retained; g != e {
+		t.Fatal(g, e)
+	}
+
+	if n, bytes := b.TransientStats(); n != 1 || bytes != 1000 {
+		t.Fatal(n, bytes)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	b := NewStack(2)
+	b.Alloc(100)
+	b.Free()
+	b.Freeze()
+	buf := b.Alloc(50) // Reuses the retained buffer.
+	b.Free()
+	if err := recovered(func() { b.Alloc(cap(buf) + 1) }); !errors.Is(err, ErrFrozen) {
+		t.Fatal(err)
+	}
+
+	buf = b.Alloc(10)
+	if err := recovered(func() { b.Grow(buf, cap(buf)) }); !errors.Is(err, ErrFrozen) {
+		t.Fatal(err)
+	}
+
+	b.Unfreeze()
+	b.Grow(buf, cap(buf))
+}
+
 const (
 	N       = 1e5
 	bufSize = 1 << 12
@@ -149,6 +494,225 @@ func TestFoo(t *testing.T) {
 	}
 }
 
+func TestZeroAlloc(t *testing.T) {
+	b := NewWithOptions(1, &Options{ZeroAlloc: ZeroAllocEmpty})
+	if r := b.Alloc(0); r == nil || cap(r) != 0 || b.Depth() != 0 {
+		t.Fatal(r == nil, cap(r), b.Depth())
+	}
+
+	b = NewWithOptions(1, &Options{ZeroAlloc: ZeroAllocPanic})
+	if err := recovered(func() { b.Alloc(0) }); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	b = NewStack(1)
+	b.Alloc(0)
+	if g, e := b.Depth(), 1; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestClone(t *testing.T) {
+	b := NewWithOptions(3, &Options{Policy: LRU, LargeThreshold: 100, Checked: true})
+	b.Alloc(10)
+	c := b.Clone()
+	if g, e := c.Remaining(), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if c.Stats() != 0 || c.policy != LRU || c.large != 100 || !c.checked {
+		t.Fatal(c.Stats(), c.policy, c.large, c.checked)
+	}
+}
+
+func TestForEachChunk(t *testing.T) {
+	b := NewStack(1)
+	var sizes []int
+	if err := b.ForEachChunk(25, 10, func(chunk []byte) error {
+		sizes = append(sizes, len(chunk))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(sizes), "[10 10 5]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	if err := b.ForEachChunk(25, 10, func([]byte) error { calls++; return errStop }); err != errStop || calls != 1 {
+		t.Fatal(err, calls)
+	}
+
+	if g, e := b.Depth(), 0; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestStatsIncremental(t *testing.T) {
+	walk := func(b *Stack) (bytes int) {
+		for _, v := range b.s[:cap(b.s)] {
+			bytes += cap(v.b)
+		}
+		return bytes
+	}
+
+	check := func(b *Stack) {
+		t.Helper()
+		if g, e := b.Stats(), int64(walk(b)); g != e {
+			t.Fatal(g, e)
+		}
+	}
+
+	b := NewWithOptions(4, &Options{LargeThreshold: 1000})
+	b.Alloc(10)
+	b.Free()
+	check(&b)
+	b.Alloc(100)
+	y := b.Alloc(5000)
+	check(&b)
+	b.Grow(y, 10000)
+	b.Free()
+	check(&b)
+	b.Free()
+	check(&b)
+	b.Shrink(1)
+	check(&b)
+
+	b = NewWithSlotCaps([]int{64})
+	b.Alloc(100)
+	b.Free()
+	check(&b)
+
+	b = NewWithOptions(2, &Options{DetectEscapes: true})
+	b.Alloc(10)
+	b.Free()
+	check(&b)
+
+	var c CCache
+	for _, n := range []int{10, 100, 20, 1000, 0} {
+		c.Put(c.Get(n))
+		v, release := c.AllocVec(n, 2)
+		c.Put(c.Cget(len(v[0]) + 1))
+		release()
+		if n, bytes := c.Stats64(); n != len(c.c) || bytes != c.c.bytes() {
+			t.Fatal(n, bytes, len(c.c), c.c.bytes())
+		}
+	}
+}
+
+func TestTrimToFit(t *testing.T) {
+	b := NewStack(3)
+	b.Alloc(100)
+	b.Alloc(1e4)
+	b.Alloc(10)
+	b.Free()
+	b.Free()
+	b.Free()
+	b.TrimToFit()
+	b.Alloc(100)
+	b.Free()
+	// The buffer of 1e4 is reallocated, the smaller ones are kept.
+	fit := int64(2*overCommit(100) + overCommit(10))
+	before := b.Stats()
+	if g, e := b.TrimToFit(), before-fit; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Stats(), fit; g != e {
+		t.Fatal(g, e)
+	}
+
+	// No requests, all buffers are dropped.
+	if g, e := b.TrimToFit(), fit; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g := b.Stats(); g != 0 {
+		t.Fatal(g)
+	}
+}
+
+func TestZeroLength(t *testing.T) {
+	for _, c := range []TryAllocator{&Cache{}, &CCache{}, NewShardedCache(2), NewLFCache(16, 2)} {
+		c.Put(nil)
+		c.Put([]byte{})
+		c.Put(make([]byte, 0, 16))
+		for _, r := range [][]byte{c.Get(0), func() []byte { r, _ := c.TryGet(0); return r }()} {
+			if r == nil || cap(r) != 0 {
+				t.Fatalf("%T %v %d", c, r == nil, cap(r))
+			}
+		}
+
+		if r, ok := c.TryGet(1); !ok || cap(r) != 16 {
+			t.Fatalf("%T %v %d", c, ok, cap(r))
+		}
+
+		if _, ok := c.TryGet(1); ok {
+			t.Fatalf("%T", c)
+		}
+
+		if raceEnabled {
+			continue
+		}
+
+		if g := testing.AllocsPerRun(10, func() { c.Get(0) }); g != 0 {
+			t.Fatalf("%T %v", c, g)
+		}
+	}
+}
+
+func TestSizeEWMA(t *testing.T) {
+	b := Make(WithSlots(1), WithSizeEWMA(0.5))
+	b.Alloc(1e4)
+	b.Free()
+	for range 10 {
+		b.Alloc(100)
+		b.Free()
+	}
+	b.Trim()
+	avg := 1e4
+	for range 10 {
+		avg += 0.5 * (100 - avg)
+	}
+	if g, e := b.Stats(), int64(overCommit(int(math.Ceil(avg)))); g != e {
+		t.Fatal(g, e)
+	}
+
+	// A buffer within twice the average is kept.
+	b.Alloc(300)
+	b.Free()
+	b.Trim()
+	if g, e := b.Stats(), int64(overCommit(300)); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestAllocCap(t *testing.T) {
+	b := NewStack(2)
+	r := b.AllocCap(10, 100)
+	if len(r) != 10 || cap(r) < 100 {
+		t.Fatal(len(r), cap(r))
+	}
+
+	p := &r[0]
+	r = append(r, make([]byte, 90)...)
+	if &r[0] != p {
+		t.Fatal("reallocated")
+	}
+
+	b.Free()
+	if r = b.AllocCap(20, 5); len(r) != 20 || &r[0] != p {
+		t.Fatal(len(r))
+	}
+}
+
+func (c Cache) bytes() (r int64) {
+	_, r = c.Stats64()
+	return r
+}
+
 func TestFooBufs(t *testing.T) {
 	foo := NewFooBufs()
 	for i := 0; i < N; i++ {
@@ -172,3 +736,99 @@ func BenchmarkFooBufs(b *testing.B) {
 		foo.Bar(bufSize)
 	}
 }
+
+func BenchmarkCalloc1M(b *testing.B) {
+	buffers := NewStack(1)
+	b.SetBytes(1 << 20)
+	for i := 0; i < b.N; i++ {
+		buffers.Calloc(1 << 20)
+		buffers.Free()
+	}
+}
+
+func BenchmarkCallocN1M(b *testing.B) {
+	buffers := NewStack(1)
+	b.SetBytes(1 << 20)
+	for i := 0; i < b.N; i++ {
+		buffers.CallocN(1<<20, 64)
+		buffers.Free()
+	}
+}
+
+// TestByteAccounting64 simulates multi-GiB retention, which overflows an int
+// on 32-bit platforms.
+func TestByteAccounting64(t *testing.T) {
+	const gib int64 = 1 << 30
+
+	b := NewStack(2)
+	b.Alloc(100)
+	b.Free()
+	b.bytes += 3 * gib
+	b.transB += uint64(5 * gib)
+	if g, e := b.Stats(), 3*gib+int64(overCommit(100)); g != e {
+		t.Fatal(g, e)
+	}
+
+	if _, g := b.TransientStats(); g != uint64(5*gib) {
+		t.Fatal(g)
+	}
+
+	if g := b.Snapshot().Retained; g != 3*gib+int64(overCommit(100)) {
+		t.Fatal(g)
+	}
+
+	var c CCache
+	c.bytes = 3 * gib
+	c.Put(make([]byte, 100))
+	if _, g := c.Stats64(); g != 3*gib+100 {
+		t.Fatal(g)
+	}
+
+	ps := NewPoolSet(1)
+	p := ps.GetPool("a", nil)
+	buf, err := p.AllocTimeout(100, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retained := 3*gib + int64(cap(buf))
+	p.Free(buf)
+	p.mu.Lock()
+	p.cachedB += 3 * gib
+	p.mu.Unlock()
+	p.transB += uint64(5 * gib)
+	if _, g := p.Stats(); g != retained {
+		t.Fatal(g)
+	}
+
+	if g := p.Metrics().RetainedBytes; g != retained {
+		t.Fatal(g)
+	}
+
+	if _, g := p.TransientStats(); g != uint64(5*gib) {
+		t.Fatal(g)
+	}
+
+	if _, g := ps.Stats(); g != retained {
+		t.Fatal(g)
+	}
+}
+
+func TestBuffersSlice(t *testing.T) {
+	b := make(Buffers, 2)
+	x := b.Alloc(10)
+	y := b.Calloc(20)
+	b.Free()
+	b.Free()
+	if g, e := b.Stats(), cap(x)+cap(y); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := len(b), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := recovered(func() { b.Alloc(-1) }); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+}
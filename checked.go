@@ -0,0 +1,218 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"unsafe"
+)
+
+// This file implements the checked mode of Stack and Pool, see the Checked
+// option.
+//
+// In checked mode Pool.Free verifies the buffer being freed does not overlap
+// any retained buffer, which happens when freeing the same buffer twice or
+// freeing a sub-slice of a retained buffer. The panic reports the call sites
+// of both Free calls.
+//
+// In checked mode Stack and Pool also compute a checksum of every buffer
+// retained by Free and verify it when the buffer is reused. A mismatch means
+// the buffer was written through a stale reference after Free and the
+// allocation panics with an error satisfying errors.Is(err, ErrModified),
+// reporting the call site of the Free.
+
+// Borrow returns buf[off:off+n] with capacity limited to n, so appending to
+// it cannot overwrite buf. buf must be a buffer allocated from p and not yet
+// freed. In checked mode the sub-slice is registered as an outstanding
+// borrow and Free panics, with an error satisfying errors.Is(err,
+// ErrBorrowed), when freeing buf before calling release. Otherwise release is
+// a no-op.
+//
+// Borrow makes the common pattern of handing a sub-slice to a decoder, which
+// may hold on to it, checkable.
+func (p *Stack) Borrow(buf []byte, off, n int) (r []byte, release func()) {
+	r = buf[off : off+n : off+n]
+	if !p.checked {
+		return r, func() {}
+	}
+
+	s := p.owner(buf)
+	if s == nil {
+		p.fail(errors.New("Stack.Borrow: buffer not allocated"))
+	}
+
+	s.borrows++
+	return r, releaser(func() {
+		// The slots may have been moved by GrowSlots, look up again.
+		if s := p.owner(buf); s != nil {
+			s.borrows--
+		}
+	})
+}
+
+// owner returns the allocated slot containing buf, if any.
+func (p *Stack) owner(buf []byte) *slot {
+	for i := len(p.s); i < cap(p.s); i++ {
+		if s := &p.s[:cap(p.s)][i]; contains(s.b, buf) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Borrow returns buf[off:off+n] with capacity limited to n, so appending to
+// it cannot overwrite buf. buf must be a buffer returned by AllocCtx and not
+// yet freed. In checked mode the sub-slice is registered as an outstanding
+// borrow and Free panics, with an error satisfying errors.Is(err,
+// ErrBorrowed), when freeing buf before calling release. Otherwise release is
+// a no-op.
+func (p *Pool) Borrow(buf []byte, off, n int) (r []byte, release func()) {
+	r = buf[off : off+n : off+n]
+	if !p.checked {
+		return r, func() {}
+	}
+
+	k := &buf[:1][0]
+	p.mu.Lock()
+	p.borrows[k]++
+	p.mu.Unlock()
+	released := false
+	return r, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if released {
+			panic(errors.New("Pool.Borrow: borrow released twice"))
+		}
+
+		released = true
+		if p.borrows[k]--; p.borrows[k] == 0 {
+			delete(p.borrows, k)
+		}
+	}
+}
+
+func releaser(release func()) func() {
+	released := false
+	return func() {
+		if released {
+			panic(errors.New("Stack.Borrow: borrow released twice"))
+		}
+
+		released = true
+		release()
+	}
+}
+
+// contains reports whether b's backing array contains the first byte of sub.
+func contains(b, sub []byte) bool {
+	if cap(b) == 0 || cap(sub) == 0 {
+		return false
+	}
+
+	p, q := addr(b), addr(sub)
+	return q >= p && q < p+uintptr(cap(b))
+}
+
+// check verifies s, the slot about to be freed.
+func (p *Stack) check(s *slot) {
+	if s.borrows != 0 {
+		p.fail(fmt.Errorf("Stack.Free: %d outstanding borrow(s): %w", s.borrows, ErrBorrowed))
+	}
+}
+
+// check verifies b, the buffer about to be freed, and records the call site
+// of Free. It must be called with p.mu held.
+func (p *Pool) check(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	if n := p.borrows[&b[:1][0]]; n != 0 {
+		p.mu.Unlock()
+		panic(fmt.Errorf("Pool.Free: %d outstanding borrow(s): %w", n, ErrBorrowed))
+	}
+
+	site := callSite(4)
+	for _, v := range p.c {
+		if overlap(b, v) {
+			p.mu.Unlock()
+			panic(fmt.Errorf("Pool.Free: buffer freed at %s overlaps a buffer freed at %s: %w", site, p.sites[addr(v)], ErrOverlap))
+		}
+	}
+	p.sites[addr(b)] = site
+}
+
+// verify panics if the free slot s, about to be reused, was modified after
+// Free.
+func (p *Stack) verify(s *slot) {
+	if s.site == "" {
+		return
+	}
+
+	site := s.site
+	s.site = ""
+	if cap(s.b) != 0 && checksum(s.b) != s.sum {
+		p.fail(fmt.Errorf("Stack.Alloc: buffer freed at %s: %w", site, ErrModified))
+	}
+}
+
+// verify panics if r, a buffer about to be returned by get, was modified
+// after Free. It also forgets the checksums of the buffers discarded by get.
+// It must be called with p.mu held.
+func (p *Pool) verify(r []byte) {
+	if sum, ok := p.sums[addr(r)]; ok {
+		delete(p.sums, addr(r))
+		if checksum(r) != sum {
+			site := p.sites[addr(r)]
+			p.mu.Unlock()
+			panic(fmt.Errorf("Pool.AllocCtx: buffer freed at %s: %w", site, ErrModified))
+		}
+	}
+	if len(p.sums) <= len(p.c) {
+		return
+	}
+
+	retained := make(map[uintptr]struct{}, len(p.c))
+	for _, v := range p.c {
+		retained[addr(v)] = struct{}{}
+	}
+	for k := range p.sums {
+		if _, ok := retained[k]; !ok {
+			delete(p.sums, k)
+		}
+	}
+}
+
+// checksum returns the checksum of b up to its capacity.
+func checksum(b []byte) uint32 { return crc32.ChecksumIEEE(b[:cap(b)]) }
+
+// addr returns the address of b's backing array.
+func addr(b []byte) uintptr { return uintptr(unsafe.Pointer(&b[:1][0])) }
+
+// overlap reports whether the backing arrays of a and b, up to their
+// capacities, overlap.
+func overlap(a, b []byte) bool {
+	if cap(a) == 0 || cap(b) == 0 {
+		return false
+	}
+
+	p, q := addr(a), addr(b)
+	return p < q+uintptr(cap(b)) && q < p+uintptr(cap(a))
+}
+
+// callSite returns the position of the caller skip frames up the stack, as
+// for runtime.Caller, where skip 0 is callSite itself.
+func callSite(skip int) string {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return "?"
+	}
+
+	return fmt.Sprintf("%s:%d", file, line)
+}
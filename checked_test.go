@@ -0,0 +1,87 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBorrow(t *testing.T) {
+	b := NewWithOptions(2, &Options{Checked: true})
+	buf := b.Alloc(10)
+	b.Alloc(20)
+	sub, release := b.Borrow(buf, 2, 3)
+	if g, e := cap(sub), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	if err := recovered(b.Free); !errors.Is(err, ErrBorrowed) {
+		t.Fatal(err)
+	}
+
+	release()
+	b.Free()
+	if err := recovered(release); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	p := NewPool(1, &Options{Checked: true})
+	buf, _ = p.AllocCtx(context.Background(), 10)
+	_, release = p.Borrow(buf, 0, 10)
+	if err := recovered(func() { p.Free(buf) }); !errors.Is(err, ErrBorrowed) {
+		t.Fatal(err)
+	}
+
+	release()
+	p.Free(buf)
+}
+
+func TestOverlap(t *testing.T) {
+	p := NewPool(2, &Options{Checked: true})
+	a, _ := p.AllocCtx(context.Background(), 10)
+	p.Free(a)
+	err := recovered(func() { p.Free(a[4:]) })
+	if !errors.Is(err, ErrOverlap) {
+		t.Fatal(err)
+	}
+
+	if g, e := strings.Count(err.Error(), "checked_test.go:"), 2; g != e {
+		t.Fatal(err, g, e)
+	}
+
+	a, _ = p.AllocCtx(context.Background(), 10)
+	b, _ := p.AllocCtx(context.Background(), 10)
+	p.Free(a)
+	p.Free(b)
+}
+
+func TestModified(t *testing.T) {
+	b := NewWithOptions(1, &Options{Checked: true})
+	stale := b.Alloc(10)
+	b.Free()
+	b.Alloc(10)
+	b.Free()
+	stale[3] = 42
+	err := recovered(func() { b.Alloc(10) })
+	if !errors.Is(err, ErrModified) || !strings.Contains(err.Error(), "checked_test.go:") {
+		t.Fatal(err)
+	}
+
+	p := NewPool(1, &Options{Checked: true})
+	ctx := context.Background()
+	stale, _ = p.AllocCtx(ctx, 10)
+	p.Free(stale)
+	a, _ := p.AllocCtx(ctx, 10)
+	p.Free(a)
+	stale[3] = 42
+	err = recovered(func() { p.AllocCtx(ctx, 10) })
+	if !errors.Is(err, ErrModified) || !strings.Contains(err.Error(), "checked_test.go:") {
+		t.Fatal(err)
+	}
+}
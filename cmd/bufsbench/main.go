@@ -0,0 +1,116 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command bufsbench compares the allocators of package bufs, and the usual
+// alternatives, under a synthetic workload and prints the results.
+//
+// Usage:
+//
+//	bufsbench [flags]
+//
+// Flags:
+//
+//	-g n         goroutines, default GOMAXPROCS
+//	-ops n       ops per goroutine, default 1e5
+//	-depth n     nested allocations per op, default 2
+//	-min n       minimal request size, default 4096
+//	-max n       maximal request size, default -min
+//	-only list   comma separated names of the allocators to run
+//	-policy p    Stack policy: largest, lru or closest
+//	-large n     Options.LargeThreshold
+//	-softlimit n Options.SoftLimit
+//	-checked     Options.Checked
+//
+// The workload is that of Foo and FooBufs in the tests of package bufs:
+// every op allocates -depth buffers, each touched once, and frees them in
+// the reverse order. See package github.com/cznic/bufs/bench for the
+// library doing the work.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/cznic/bufs"
+	"github.com/cznic/bufs/bench"
+)
+
+func main() {
+	if err := main1(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func main1(args []string) error {
+	fs := flag.NewFlagSet("bufsbench", flag.ContinueOnError)
+	g := fs.Int("g", 0, "goroutines, default GOMAXPROCS")
+	ops := fs.Int("ops", 1e5, "ops per goroutine")
+	depth := fs.Int("depth", 2, "nested allocations per op")
+	minSize := fs.Int("min", 4096, "minimal request size")
+	maxSize := fs.Int("max", 0, "maximal request size, default -min")
+	only := fs.String("only", "", "comma separated names of the allocators to run")
+	policy := fs.String("policy", "largest", "Stack policy: largest, lru or closest")
+	large := fs.Int("large", 0, "Options.LargeThreshold")
+	softLimit := fs.Int("softlimit", 0, "Options.SoftLimit")
+	checked := fs.Bool("checked", false, "Options.Checked")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	o := &bufs.Options{LargeThreshold: *large, SoftLimit: *softLimit, Checked: *checked}
+	switch *policy {
+	case "largest":
+		o.Policy = bufs.Largest
+	case "lru":
+		o.Policy = bufs.LRU
+	case "closest":
+		o.Policy = bufs.ClosestFit
+	default:
+		return fmt.Errorf("invalid policy: %s", *policy)
+	}
+
+	lo, hi := *minSize, max(*maxSize, *minSize)
+	c := bench.Config{
+		Goroutines: *g,
+		Ops:        *ops,
+		Depth:      *depth,
+		Size:       func(r *rand.Rand) int { return lo + r.Intn(hi-lo+1) },
+		Work:       func(b []byte) { touch(b) },
+	}
+	var candidates []bench.Candidate
+	for _, v := range bench.Candidates(c, o) {
+		if *only == "" || contains(*only, v.Name) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no allocator matches -only %s", *only)
+	}
+
+	return bench.Print(os.Stdout, bench.Compare(c, candidates)...)
+}
+
+var sink byte
+
+// touch reads b, like Foo.Bar does.
+func touch(b []byte) {
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	sink += sum
+}
+
+func contains(list, name string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"sync"
+)
+
+// Composite is an Allocator trying a primary allocator first and falling back
+// to another one, see Compose. A Composite is safe for concurrent use by
+// multiple goroutines if both its allocators are.
+type Composite struct {
+	mu        sync.Mutex
+	fallback  Allocator
+	fallbacks uint64
+	gets      uint64
+	owned     map[uintptr]struct{} // Buffers obtained from fallback.
+	primary   TryAllocator
+}
+
+// Compose returns a Composite allocating from primary if it can do so,
+// otherwise from fallback. Put returns buffers to the allocator they were
+// obtained from. Composites nest, so for example a per-object Cache can be put
+// in front of a shared LFCache in front of Heap:
+//
+//	a := Compose(&cache, Compose(lfcache, Heap{}))
+func Compose(primary TryAllocator, fallback Allocator) *Composite {
+	return &Composite{fallback: fallback, owned: map[uintptr]struct{}{}, primary: primary}
+}
+
+// Get implements Allocator.
+func (c *Composite) Get(n int) []byte {
+	checkSize("Composite.Get", n)
+	if r, ok := c.try(n); ok {
+		return r
+	}
+
+	r := c.fallback.Get(n)
+	c.fell(r)
+	return r
+}
+
+// TryGet implements TryAllocator. It fails if both the primary and the
+// fallback allocators refuse to allocate. Allocators not implementing
+// TryAllocator never refuse.
+func (c *Composite) TryGet(n int) ([]byte, bool) {
+	checkSize("Composite.TryGet", n)
+	if r, ok := c.try(n); ok {
+		return r, true
+	}
+
+	f, ok := c.fallback.(TryAllocator)
+	if !ok {
+		r := c.fallback.Get(n)
+		c.fell(r)
+		return r, true
+	}
+
+	r, ok := f.TryGet(n)
+	if ok {
+		c.fell(r)
+	}
+	return r, ok
+}
+
+// try attempts to allocate from c.primary.
+func (c *Composite) try(n int) ([]byte, bool) {
+	c.mu.Lock()
+	c.gets++
+	c.mu.Unlock()
+	return c.primary.TryGet(n)
+}
+
+// fell records b was obtained from c.fallback.
+func (c *Composite) fell(b []byte) {
+	c.mu.Lock()
+	c.fallbacks++
+	if cap(b) != 0 {
+		c.owned[addr(b)] = struct{}{}
+	}
+	c.mu.Unlock()
+}
+
+// Put implements Allocator.
+func (c *Composite) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	_, ok := c.owned[addr(b)]
+	delete(c.owned, addr(b))
+	c.mu.Unlock()
+	if ok {
+		c.fallback.Put(b)
+		return
+	}
+
+	c.primary.Put(b)
+}
+
+// Stats reports the number of Get and TryGet calls and how many of them were
+// served by the fallback allocator.
+func (c *Composite) Stats() (gets, fallbacks uint64) {
+	c.mu.Lock()
+	gets, fallbacks = c.gets, c.fallbacks
+	c.mu.Unlock()
+	return gets, fallbacks
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	var cache Cache
+	var shared CCache
+	a := Compose(&cache, &shared)
+	b := a.Get(10) // Shared.
+	a.Put(b)
+	if n, _ := shared.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	cache.Put(make([]byte, 100))
+	b = a.Get(20) // Cache.
+	a.Put(b)
+	if n, _ := cache.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, _ := shared.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if gets, fallbacks := a.Stats(); gets != 2 || fallbacks != 1 {
+		t.Fatal(gets, fallbacks)
+	}
+
+	inner := Compose(&shared, Heap{})
+	a = Compose(&cache, inner)
+	b = a.Get(200) // Heap.
+	c := a.Get(20) // Cache.
+	d := a.Get(20) // Shared.
+	a.Put(b)
+	a.Put(c)
+	a.Put(d)
+	if n, _ := cache.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, _ := shared.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if gets, fallbacks := inner.Stats(); gets != 2 || fallbacks != 1 {
+		t.Fatal(gets, fallbacks)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// compressInputSize is the size of the pooled input buffers of decompressors.
+const compressInputSize = 1 << 12
+
+// Compressors pools gzip and flate readers and writers. Compressors are safe
+// for concurrent use by multiple goroutines.
+//
+// The compression window and output buffers of the standard library
+// (de)compressors are internal to them and cannot be provided by the caller.
+// They are reused by pooling the (de)compressors as a whole. The input
+// buffers of the decompressors are obtained from a CCache.
+type Compressors struct {
+	c     *CCache
+	level int
+	fr    sync.Pool // io.ReadCloser implementing flate.Resetter
+	fw    sync.Pool // *flate.Writer
+	gr    sync.Pool // *gzip.Reader
+	gw    sync.Pool // *gzip.Writer
+}
+
+// NewCompressors returns a newly created Compressors. The writers will use
+// the compression level 'level', see compress/flate. The input buffers of
+// readers are obtained from c. If c is nil, GCache is used.
+func NewCompressors(level int, c *CCache) (*Compressors, error) {
+	if _, err := flate.NewWriter(nil, level); err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		c = &GCache
+	}
+	return &Compressors{c: c, level: level}, nil
+}
+
+// FlateWriter is a flate.Writer obtained from Compressors.
+type FlateWriter struct {
+	*flate.Writer
+	p *Compressors
+}
+
+// Close closes the flate.Writer and returns it to Compressors. The
+// FlateWriter must not be used afterwards.
+func (w *FlateWriter) Close() error {
+	err := w.Writer.Close()
+	w.p.fw.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// FlateWriter returns a FlateWriter writing compressed data to w.
+func (p *Compressors) FlateWriter(w io.Writer) *FlateWriter {
+	if x, ok := p.fw.Get().(*flate.Writer); ok {
+		x.Reset(w)
+		return &FlateWriter{x, p}
+	}
+
+	x, _ := flate.NewWriter(w, p.level) // Level checked in NewCompressors.
+	return &FlateWriter{x, p}
+}
+
+// GzipWriter is a gzip.Writer obtained from Compressors.
+type GzipWriter struct {
+	*gzip.Writer
+	p *Compressors
+}
+
+// Close closes the gzip.Writer and returns it to Compressors. The GzipWriter
+// must not be used afterwards.
+func (w *GzipWriter) Close() error {
+	err := w.Writer.Close()
+	w.p.gw.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// GzipWriter returns a GzipWriter writing compressed data to w.
+func (p *Compressors) GzipWriter(w io.Writer) *GzipWriter {
+	if x, ok := p.gw.Get().(*gzip.Writer); ok {
+		x.Reset(w)
+		return &GzipWriter{x, p}
+	}
+
+	x, _ := gzip.NewWriterLevel(w, p.level) // Level checked in NewCompressors.
+	return &GzipWriter{x, p}
+}
+
+// FlateReader is a flate decompressor obtained from Compressors.
+type FlateReader struct {
+	io.ReadCloser
+	in *byteReader
+	p  *Compressors
+}
+
+// Close closes the decompressor and returns it to Compressors. The
+// FlateReader must not be used afterwards.
+func (r *FlateReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.p.fr.Put(r.ReadCloser)
+	r.in.release(r.p.c)
+	r.ReadCloser, r.in = nil, nil
+	return err
+}
+
+// FlateReader returns a FlateReader decompressing data read from r.
+func (p *Compressors) FlateReader(r io.Reader) *FlateReader {
+	in := newByteReader(r, p.c)
+	if x, ok := p.fr.Get().(io.ReadCloser); ok {
+		x.(flate.Resetter).Reset(in, nil)
+		return &FlateReader{x, in, p}
+	}
+
+	return &FlateReader{flate.NewReader(in), in, p}
+}
+
+// GzipReader is a gzip.Reader obtained from Compressors.
+type GzipReader struct {
+	*gzip.Reader
+	in *byteReader
+	p  *Compressors
+}
+
+// Close closes the gzip.Reader and returns it to Compressors. The GzipReader
+// must not be used afterwards.
+func (r *GzipReader) Close() error {
+	err := r.Reader.Close()
+	r.p.gr.Put(r.Reader)
+	r.in.release(r.p.c)
+	r.Reader, r.in = nil, nil
+	return err
+}
+
+// GzipReader returns a GzipReader decompressing data read from r. It reads
+// the gzip header and fails if the header is not valid.
+func (p *Compressors) GzipReader(r io.Reader) (*GzipReader, error) {
+	in := newByteReader(r, p.c)
+	if x, ok := p.gr.Get().(*gzip.Reader); ok {
+		if err := x.Reset(in); err != nil {
+			p.gr.Put(x)
+			in.release(p.c)
+			return nil, err
+		}
+
+		return &GzipReader{x, in, p}, nil
+	}
+
+	x, err := gzip.NewReader(in)
+	if err != nil {
+		in.release(p.c)
+		return nil, err
+	}
+
+	return &GzipReader{x, in, p}, nil
+}
+
+// byteReader buffers an io.Reader in a pooled buffer and implements
+// io.ByteReader, which prevents flate from wrapping it in a bufio.Reader.
+type byteReader struct {
+	r   io.Reader
+	buf []byte
+	rd  int // Read offset in buf.
+	wr  int // Write offset in buf.
+	err error
+}
+
+func newByteReader(r io.Reader, c *CCache) *byteReader {
+	return &byteReader{r: r, buf: c.Get(compressInputSize)}
+}
+
+func (b *byteReader) release(c *CCache) {
+	c.Put(b.buf)
+	b.buf = nil
+}
+
+func (b *byteReader) fill() {
+	for b.rd == b.wr && b.err == nil {
+		b.rd = 0
+		b.wr, b.err = b.r.Read(b.buf)
+	}
+}
+
+func (b *byteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	b.fill()
+	if b.rd == b.wr {
+		return 0, b.err
+	}
+
+	n := copy(p, b.buf[b.rd:b.wr])
+	b.rd += n
+	return n, nil
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	b.fill()
+	if b.rd == b.wr {
+		return 0, b.err
+	}
+
+	c := b.buf[b.rd]
+	b.rd++
+	return c, nil
+}
+
+// Window sizes of common compressors, see NewForCompression.
+const (
+	FlateWindow = 32 << 10 // Deflate, gzip and zlib.
+	LZ4Block    = 64 << 10 // Default block size of the LZ4 frame format.
+)
+
+// CompressBound returns the maximal compressed length of n bytes by zstd or
+// LZ4, including the framing overhead of a block. It bounds also the output
+// of deflate with the usual block sizes.
+func CompressBound(n int) int {
+	zstd := n + n>>8
+	if n < 128<<10 {
+		zstd += (128<<10 - n) >> 11
+	}
+	lz4 := n + n/255 + 16
+	return max(zstd, lz4)
+}
+
+// NewForCompression returns a Stack tuned for a compressor or decompressor
+// working with window, the window or block size, for example FlateWindow,
+// LZ4Block or 1<<windowLog of the zstd level used. The Stack has three
+// slots, used in this nesting order:
+//
+//  1. The input, up to window bytes.
+//  2. The output, up to CompressBound(window) bytes.
+//  3. The history or a scratch area, up to 2*window bytes.
+//
+// Each slot retains only buffers up to the capacity Alloc gives the listed
+// size, bigger ones are dropped by Free, see NewWithSlotCaps. The Budget of
+// the Stack is the sum of the three, so a stray huge allocation panics
+// instead of growing the retained memory unnoticed.
+func NewForCompression(window int) Stack {
+	if window <= 0 {
+		panic(fmt.Errorf("NewForCompression: window %d: %w", window, ErrInvalidSize))
+	}
+
+	caps := []int{overCommit(window), overCommit(CompressBound(window)), overCommit(2 * window)}
+	b := NewWithOptions(len(caps), &Options{Budget: caps[0] + caps[1] + caps[2]})
+	b.caps = caps
+	return b
+}
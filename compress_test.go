@@ -0,0 +1,102 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCompressors(t *testing.T) {
+	var c CCache
+	p, err := NewCompressors(flate.BestSpeed, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("bufs "), 1e4)
+	for i := 0; i < 3; i++ {
+		var z bytes.Buffer
+		w := p.GzipWriter(&z)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := p.GzipReader(&z)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, data) {
+			t.Fatal(i)
+		}
+
+		fw := p.FlateWriter(&z)
+		fw.Write(data)
+		fw.Close()
+		fr := p.FlateReader(&z)
+		if b, err = io.ReadAll(fr); err != nil || !bytes.Equal(b, data) {
+			t.Fatal(i, err)
+		}
+
+		fr.Close()
+	}
+
+	if n, _ := c.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err := NewCompressors(42, nil); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
+
+func TestNewForCompression(t *testing.T) {
+	// The zstd bound of 64 kB exceeds the LZ4 one.
+	if g, e := CompressBound(LZ4Block), LZ4Block+LZ4Block>>8+(128<<10-LZ4Block)>>11; g != e {
+		t.Fatal(g, e)
+	}
+
+	b := NewForCompression(FlateWindow)
+	for range 2 {
+		in := b.Alloc(FlateWindow)
+		out := b.Alloc(CompressBound(len(in)))
+		b.Alloc(2 * FlateWindow)
+		if len(out) < len(in) {
+			t.Fatal(len(out), len(in))
+		}
+
+		b.Free()
+		b.Free()
+		b.Free()
+	}
+	if g, e := b.Grows(), uint64(0); g != e {
+		t.Fatal(g, e)
+	}
+
+	if n, _ := b.TransientStats(); n != 0 {
+		t.Fatal(n)
+	}
+
+	if err := recovered(func() { b.Alloc(1 << 20) }); !errors.Is(err, ErrOverBudget) {
+		t.Fatal(err)
+	}
+}
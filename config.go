@@ -0,0 +1,112 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PoolConfig is the configuration, not the contents, of a Pool. It consists
+// of plain data only, so it can be serialized, for example by encoding/json or
+// encoding/gob, and handed over to a new process on a graceful restart. The
+// new process then reconstructs an equivalently configured Pool, see
+// Pool.Config and PoolConfig.NewPool. The fields have the meaning of the
+// Options of the same name.
+type PoolConfig struct {
+	// Key is the name the Pool is registered under in a PoolSet, see
+	// PoolSet.GetPool. It may differ from Name. Pool.Config leaves it
+	// empty, PoolSet.Config sets it.
+	Key string
+
+	N                   int // Maximum number of allocated buffers, see NewPool.
+	Name                string
+	ProfileLabels       bool
+	Checked             bool
+	Reserve             int
+	SaturationThreshold time.Duration
+	LargeThreshold      int
+	MaxHold             time.Duration
+	Watchdog            time.Duration
+	Weights             map[string]int
+	FailEveryN          int
+	TouchPages          bool
+}
+
+// Config returns the configuration of p.
+func (p *Pool) Config() PoolConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolConfig{
+		N:                   p.n,
+		Name:                p.name,
+		ProfileLabels:       p.labels != nil,
+		Checked:             p.checked,
+		Reserve:             p.reserve,
+		SaturationThreshold: p.threshold,
+		LargeThreshold:      p.large,
+		MaxHold:             p.maxHold,
+		Watchdog:            p.watchdog,
+		Weights:             maps.Clone(p.weights),
+		FailEveryN:          p.failN,
+		TouchPages:          p.touch,
+	}
+}
+
+// NewPool returns a newly created Pool configured by c. The options which
+// cannot be serialized, Hook, Clock and Record, are taken from o, which may
+// be nil. The other fields of o are ignored.
+func (c PoolConfig) NewPool(o *Options) *Pool {
+	var opts Options
+	if o != nil {
+		opts.Hook, opts.Clock, opts.Record = o.Hook, o.Clock, o.Record
+	}
+	opts.Name = c.Name
+	opts.ProfileLabels = c.ProfileLabels
+	opts.Checked = c.Checked
+	opts.Reserve = c.Reserve
+	opts.SaturationThreshold = c.SaturationThreshold
+	opts.LargeThreshold = c.LargeThreshold
+	opts.MaxHold = c.MaxHold
+	opts.Watchdog = c.Watchdog
+	opts.Weights = maps.Clone(c.Weights)
+	opts.FailEveryN = c.FailEveryN
+	opts.TouchPages = c.TouchPages
+	return NewPool(c.N, &opts)
+}
+
+// Config returns the configurations of the Pools in s, with their Key set,
+// ordered by Key.
+func (s *PoolSet) Config() []PoolConfig {
+	s.mu.Lock()
+	pools := maps.Clone(s.pools)
+	s.mu.Unlock()
+
+	r := make([]PoolConfig, 0, len(pools))
+	for key, p := range pools {
+		c := p.Config()
+		c.Key = key
+		r = append(r, c)
+	}
+	slices.SortFunc(r, func(a, b PoolConfig) int { return strings.Compare(a.Key, b.Key) })
+	return r
+}
+
+// Restore creates the Pools configured by configs, as by PoolConfig.NewPool,
+// under their Key, so GetPool(Key) finds them. Pools already existing in s
+// are kept as they are.
+func (s *PoolSet) Restore(configs []PoolConfig, o *Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range configs {
+		if s.pools[c.Key] == nil {
+			s.pools[c.Key] = c.NewPool(o)
+		}
+	}
+}
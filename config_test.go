@@ -0,0 +1,78 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoolConfig(t *testing.T) {
+	o := &Options{
+		Name:                "rpc",
+		ProfileLabels:       true,
+		Reserve:             2,
+		SaturationThreshold: time.Second,
+		LargeThreshold:      1 << 20,
+		MaxHold:             time.Minute,
+		Watchdog:            time.Hour,
+		Weights:             map[string]int{"a": 1, "b": 3},
+		FailEveryN:          7,
+		TouchPages:          true,
+	}
+	c := NewPool(4, o).Config()
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d PoolConfig
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &testClock{}
+	p := d.NewPool(&Options{Clock: clock, Reserve: 100})
+	if p.clock != clock {
+		t.Fatal("Clock not applied")
+	}
+
+	if g, e := p.Config(), c; !reflect.DeepEqual(g, e) {
+		t.Fatalf("\ngot %+v\nexp %+v", g, e)
+	}
+
+	s := NewPoolSet(1)
+	s.GetPool("b", nil)
+	s.GetPool("a", &Options{Checked: true})
+	x := s.GetPool("x", &Options{Name: "named"})
+	cs := s.Config()
+	if g, e := len(cs), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if cs[0].Key != "a" || cs[0].Name != "a" || !cs[0].Checked || cs[1].Key != "b" || cs[2].Key != "x" || cs[2].Name != "named" {
+		t.Fatalf("%+v", cs)
+	}
+
+	s2 := NewPoolSet(2)
+	s2.GetPool("b", nil)
+	c.Key = "c"
+	s2.Restore(append(cs, c), nil)
+	if g, e := s2.Config(), []PoolConfig{cs[0], {Key: "b", N: 2, Name: "b"}, c, cs[2]}; !reflect.DeepEqual(g, e) {
+		t.Fatalf("\ngot %+v\nexp %+v", g, e)
+	}
+
+	// The key and the name differ, GetPool must find the restored pool.
+	y := s2.GetPool("x", nil)
+	if g, e := y.Config(), x.Config(); !reflect.DeepEqual(g, e) {
+		t.Fatalf("\ngot %+v\nexp %+v", g, e)
+	}
+
+	if g, e := len(s2.Config()), 4; g != e {
+		t.Fatal(g, e)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// DictCache retains decoded (de)compression dictionaries, for example those
+// used with flate.NewReaderDict or zstd, keyed by the dictionary ID or hash.
+// The least recently used dictionaries are evicted when the combined size of
+// the cached dictionaries exceeds the configured limit.
+//
+// The dictionaries are shared by all users of the cache and must not be
+// modified. Evicted dictionaries are left to the garbage collector, so the
+// users still holding them are not affected.
+//
+// A DictCache is safe for concurrent use by multiple goroutines.
+type DictCache struct {
+	mu    sync.Mutex
+	bytes int64 // Combined size of the loaded dictionaries.
+	lru   list.List
+	m     map[uint64]*list.Element
+	max   int64
+}
+
+type dictEntry struct {
+	id    uint64
+	b     []byte
+	err   error
+	ready chan struct{} // Closed when b and err are set.
+}
+
+// NewDictCache returns a newly created DictCache retaining at most maxBytes
+// of dictionaries. It panics with ErrInvalidSize if maxBytes is negative.
+func NewDictCache(maxBytes int) *DictCache {
+	if maxBytes < 0 {
+		panic(fmt.Errorf("NewDictCache: maxBytes %d: %w", maxBytes, ErrInvalidSize))
+	}
+
+	return &DictCache{m: map[uint64]*list.Element{}, max: int64(maxBytes)}
+}
+
+// Get returns the dictionary identified by id. If it's not cached, Get calls
+// load to obtain it. Concurrent Gets of the same id call load only once and
+// share its result. Errors returned by load are not cached.
+func (c *DictCache) Get(id uint64, load func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if el := c.m[id]; el != nil {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		e := el.Value.(*dictEntry)
+		<-e.ready
+		return e.b, e.err
+	}
+
+	e := &dictEntry{id: id, ready: make(chan struct{})}
+	el := c.lru.PushFront(e)
+	c.m[id] = el
+	c.mu.Unlock()
+
+	b, err := load()
+
+	c.mu.Lock()
+	e.b, e.err = b, err
+	switch {
+	case err != nil:
+		c.remove(el)
+	case c.m[id] == el: // Not evicted while loading.
+		c.bytes += int64(len(b))
+		for c.bytes > c.max && c.lru.Len() != 0 {
+			c.remove(c.lru.Back())
+		}
+	}
+	c.mu.Unlock()
+	close(e.ready)
+	return b, err
+}
+
+// remove removes el from c. It must be called with c.mu held.
+func (c *DictCache) remove(el *list.Element) {
+	e := el.Value.(*dictEntry)
+	if c.m[e.id] == el {
+		delete(c.m, e.id)
+	}
+	c.lru.Remove(el)
+	c.bytes -= int64(len(e.b))
+}
+
+// Stats reports the number of cached dictionaries and their combined size.
+func (c *DictCache) Stats() (n int, bytes int64) {
+	c.mu.Lock()
+	n, bytes = c.lru.Len(), c.bytes
+	c.mu.Unlock()
+	return n, bytes
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDictCache(t *testing.T) {
+	c := NewDictCache(250)
+	var loads atomic.Int32
+	load := func(n int) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			loads.Add(1)
+			return make([]byte, n), nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b, err := c.Get(1, load(100)); err != nil || len(b) != 100 {
+				t.Error(len(b), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if g, e := loads.Load(), int32(1); g != e {
+		t.Fatal(g, e)
+	}
+
+	c.Get(2, load(100))
+	c.Get(1, load(100)) // 1 becomes the most recently used.
+	c.Get(3, load(100)) // Evicts 2.
+	if n, bytes := c.Stats(); n != 2 || bytes != 200 {
+		t.Fatal(n, bytes)
+	}
+
+	loads.Store(0)
+	c.Get(1, load(100))
+	c.Get(2, load(100))
+	if g, e := loads.Load(), int32(1); g != e {
+		t.Fatal(g, e)
+	}
+
+	errLoad := errors.New("load")
+	if _, err := c.Get(4, func() ([]byte, error) { return nil, errLoad }); err != errLoad {
+		t.Fatal(err)
+	}
+
+	if b, err := c.Get(4, load(10)); err != nil || len(b) != 10 {
+		t.Fatal(len(b), err)
+	}
+
+	if err := recovered(func() { NewDictCache(-1) }); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	c = NewDictCache(0)
+	if b, err := c.Get(5, load(10)); err != nil || len(b) != 10 {
+		t.Fatal(len(b), err)
+	}
+
+	if n, bytes := c.Stats(); n != 0 || bytes != 0 {
+		t.Fatal(n, bytes)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snapshot is a point in time copy of the statistics of a pool, see
+// Stack.Snapshot, Pool.Snapshot and DiffStats. Fields not applicable to
+// the particular pool are zero. The cumulative counters are uint64 and wrap
+// around, see Delta.
+type Snapshot struct {
+	Slots          int    // Stack: number of slots. Pool: maximum number of allocated buffers.
+	InUse          int    // Number of allocated buffers.
+	Peak           int    // Stack only: see Stack.Peak.
+	Retained       int64  // Combined capacity of the retained buffers, see Stats.
+	Grows          uint64 // Stack only: see Stack.Grows.
+	Transient      uint64 // Number of buffers not retained, see TransientStats.
+	TransientBytes uint64 // Their combined capacity.
+	Hits           uint64 // Pool only: see PoolMetrics.
+	Misses         uint64 // Pool only: see PoolMetrics.
+}
+
+// Snapshot returns the current statistics of p.
+func (p *Stack) Snapshot() Snapshot {
+	return Snapshot{
+		Slots:          cap(p.s),
+		InUse:          p.Depth(),
+		Peak:           p.peak,
+		Retained:       p.bytes,
+		Grows:          p.grows,
+		Transient:      p.transN,
+		TransientBytes: p.transB,
+	}
+}
+
+// Snapshot returns the current statistics of p.
+func (p *Pool) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Snapshot{
+		Slots:          p.n,
+		InUse:          p.used,
+		Retained:       p.cachedB,
+		Transient:      p.transN,
+		TransientBytes: p.transB,
+		Hits:           p.hits,
+		Misses:         p.misses,
+	}
+}
+
+// Report is a summary of the differences of two Snapshots, see DiffStats.
+type Report struct {
+	// Changes describe the notable differences, one per item, in a fixed
+	// order. Empty if there are none.
+	Changes []string
+}
+
+// String returns the changes separated by "; ", or "no changes".
+func (r Report) String() string {
+	if len(r.Changes) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(r.Changes, "; ")
+}
+
+// DiffStats summarizes what changed between the snapshots a and b of the same
+// pool, a being the older one: the capacity, a new peak, more slot growths,
+// more buffers not retained, the hit rate in between and the retained bytes.
+// It makes periodic log lines compact and meaningful.
+func DiffStats(a, b Snapshot) Report {
+	var r Report
+	add := func(format string, args ...any) { r.Changes = append(r.Changes, fmt.Sprintf(format, args...)) }
+	switch {
+	case b.Slots < a.Slots:
+		add("capacity shrunk %d -> %d", a.Slots, b.Slots)
+	case b.Slots > a.Slots:
+		add("capacity grew %d -> %d", a.Slots, b.Slots)
+	}
+	if b.Peak > a.Peak {
+		add("new peak %d (was %d)", b.Peak, a.Peak)
+	}
+	if d := Delta(a.Grows, b.Grows); d > 0 {
+		add("%d more grows", d)
+	}
+	if d := Delta(a.Transient, b.Transient); d > 0 {
+		add("%d more fallbacks (%d bytes)", d, Delta(a.TransientBytes, b.TransientBytes))
+	}
+	hits, misses := Delta(a.Hits, b.Hits), Delta(a.Misses, b.Misses)
+	if n := hits + misses; n > 0 {
+		add("hit rate %.1f%% over %d allocations", 100*float64(hits)/float64(n), n)
+	}
+	if b.Retained != a.Retained {
+		add("retained %d -> %d bytes", a.Retained, b.Retained)
+	}
+	if b.InUse != a.InUse {
+		add("in use %d -> %d", a.InUse, b.InUse)
+	}
+	return r
+}
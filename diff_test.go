@@ -0,0 +1,25 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestDiffStats(t *testing.T) {
+	b := NewWithOptions(3, &Options{LargeThreshold: 100})
+	a := b.Snapshot()
+	if g, e := DiffStats(a, a).String(), "no changes"; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Alloc(10)
+	b.Alloc(1000)
+	b.Free()
+	b.Shrink(2)
+	if g, e := DiffStats(a, b.Snapshot()).String(), "capacity shrunk 3 -> 2; new peak 2 (was 0); 1 more fallbacks (1000 bytes); retained 0 -> 20 bytes; in use 0 -> 1"; g != e {
+		t.Fatalf("\ngot  %s\nwant %s", g, e)
+	}
+}
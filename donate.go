@@ -0,0 +1,53 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// Donate makes Stack adopt buf, obtained elsewhere, for later reuse by
+// Alloc instead of allocating a buffer of their own. buf replaces the
+// smallest buffer retained by a free slot, or fills a free slot without a
+// buffer, provided the replaced buffer is smaller than buf and the Budget and
+// SoftLimit options would not be exceeded. Donate reports whether buf was
+// adopted. No other references to buf's backing array may exist afterwards
+// if it was. The replaced buffer is put back to the Backing option, if set.
+//
+// Donate never adopts buffers in the DetectEscapes mode.
+func (p *Stack) Donate(buf []byte) bool {
+	if cap(buf) == 0 || p.esc != nil {
+		return false
+	}
+
+	best := -1
+	for i, v := range p.s {
+		if v.b == nil && v.gone == SlotPoisoned {
+			continue
+		}
+
+		if best < 0 || cap(v.b) < cap(p.s[best].b) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return false
+	}
+
+	s := &p.s[best]
+	if cap(s.b) >= cap(buf) {
+		return false
+	}
+
+	bytes := p.bytes + int64(cap(buf)-cap(s.b))
+	if p.budget > 0 && bytes > int64(p.budget) || p.softLimit > 0 && bytes > int64(p.softLimit) {
+		return false
+	}
+
+	p.bytes = bytes
+	p.release(s.b)
+	*s = slot{b: buf[:cap(buf)], align: alignOf(buf)}
+	if p.ttl > 0 {
+		s.idle = p.clock.Now()
+	}
+	p.enter(SlotFree)
+	return true
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestDonate(t *testing.T) {
+	b := NewWithOptions(2, &Options{Budget: 1500})
+	b.Alloc(100) // cap 200
+	b.Free()
+	big := make([]byte, 1000)
+	if !b.Donate(big) {
+		t.Fatal("not adopted")
+	}
+
+	if g, e := b.Stats(), int64(1200); g != e {
+		t.Fatal(g, e)
+	}
+
+	if b.Donate(make([]byte, 100)) {
+		t.Fatal("adopted a smaller buffer")
+	}
+
+	if b.Donate(make([]byte, 2000)) {
+		t.Fatal("adopted over budget")
+	}
+
+	if !b.Donate(make([]byte, 500)) { // Replaces the 200.
+		t.Fatal("not adopted")
+	}
+
+	if g, e := b.Stats(), int64(1500); g != e {
+		t.Fatal(g, e)
+	}
+
+	if r := b.Alloc(900); &r[0] != &big[0] {
+		t.Fatal("donated buffer not reused")
+	}
+}
+
+func TestDonateBacking(t *testing.T) {
+	var c CCache
+	b := NewWithOptions(1, &Options{Backing: &c})
+	b.Alloc(100)
+	b.Free()
+	if n, _ := c.Stats(); n != 0 {
+		t.Fatal(n)
+	}
+
+	if !b.Donate(make([]byte, 1000)) {
+		t.Fatal("not adopted")
+	}
+
+	if n, bytes := c.Stats(); n != 1 || bytes != 200 {
+		t.Fatal(n, bytes)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// dumpOps is the number of most recent operations remembered for the
+// PanicState option.
+const dumpOps = 16
+
+// StateError is the panic value of Stack having the PanicState option set.
+// It carries a summary of the state of the Stack at the time of the panic.
+type StateError struct {
+	Err   error  // The error the Stack panicked with.
+	State string // A human readable summary of the state.
+}
+
+// Error implements error.
+func (e *StateError) Error() string { return e.Err.Error() + "\n" + e.State }
+
+// Unwrap returns e.Err.
+func (e *StateError) Unwrap() error { return e.Err }
+
+// opLog is a ring of the most recent operations of Stack.
+type opLog struct {
+	ops [dumpOps]int // Alloc size, or -1-cap for Free.
+	n   int          // Number of operations recorded.
+}
+
+func (l *opLog) alloc(n int) { l.ops[l.n%dumpOps] = n; l.n++ }
+
+func (l *opLog) free(c int) { l.ops[l.n%dumpOps] = -1 - c; l.n++ }
+
+// PanicVerbosity selects what the panics of Stack reporting ErrExhausted
+// tell about the outstanding allocations, see Options.PanicVerbosity.
+type PanicVerbosity int
+
+const (
+	// PanicTerse reports the error only.
+	PanicTerse PanicVerbosity = iota
+
+	// PanicSizes adds the requested sizes of the outstanding allocations,
+	// newest first.
+	PanicSizes
+
+	// PanicStacks adds also the call stack of every outstanding
+	// allocation. The stacks are recorded by every Alloc, which makes
+	// PanicStacks a debugging tool.
+	PanicStacks
+)
+
+// exhausted returns the ErrExhausted error of op, describing the outstanding
+// allocations as selected by the PanicVerbosity option.
+func (p *Stack) exhausted(op string) error {
+	if p.verbosity == PanicTerse {
+		return fmt.Errorf("%s: %w", op, ErrExhausted)
+	}
+
+	var b strings.Builder
+	s := p.s[len(p.s):cap(p.s)]
+	fmt.Fprintf(&b, "%d outstanding allocations (newest first):", len(s))
+	for _, v := range s {
+		fmt.Fprintf(&b, " %d", v.size)
+	}
+	if p.verbosity == PanicStacks {
+		for i, v := range s {
+			fmt.Fprintf(&b, "\n#%d, %d bytes:", i, v.size)
+			frames := runtime.CallersFrames(v.stack)
+			for {
+				f, more := frames.Next()
+				if f.PC != 0 && (filepath.Dir(f.File) != pkgDir || strings.HasSuffix(f.File, "_test.go")) {
+					fmt.Fprintf(&b, "\n\t%s\n\t\t%s:%d", f.Function, f.File, f.Line)
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%s: %w\n%s", op, ErrExhausted, b.String())
+}
+
+// callers returns the call stack of its caller's caller.
+func callers() []uintptr {
+	var pcs [32]uintptr
+	return append([]uintptr(nil), pcs[:runtime.Callers(3, pcs[:])]...)
+}
+
+// fail panics with err, annotated with the state of p if the PanicState
+// option is set.
+func (p *Stack) fail(err error) {
+	if p.ops == nil {
+		panic(err)
+	}
+
+	panic(&StateError{err, p.dumpState()})
+}
+
+// dumpState returns a summary of the state of p.
+func (p *Stack) dumpState() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stack: depth %d of %d slots, peak %d, retained %d bytes\n", p.Depth(), cap(p.s), p.peak, p.Stats())
+	b.WriteString("slots:")
+	for i, st := range p.SlotStates() {
+		fmt.Fprintf(&b, " %s/%d", st, cap(p.s[:cap(p.s)][i].b))
+	}
+	if notes := p.notes(); notes != "" {
+		fmt.Fprintf(&b, "\nnotes: %s", notes)
+	}
+	b.WriteString("\nrecent ops (oldest first):")
+	for i := max(p.ops.n-dumpOps, 0); i < p.ops.n; i++ {
+		switch op := p.ops.ops[i%dumpOps]; {
+		case op >= 0:
+			fmt.Fprintf(&b, " Alloc(%d)", op)
+		default:
+			fmt.Fprintf(&b, " Free(cap %d)", -1-op)
+		}
+	}
+	return b.String()
+}
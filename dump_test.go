@@ -0,0 +1,56 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPanicState(t *testing.T) {
+	b := NewWithOptions(2, &Options{PanicState: true})
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Free()
+	b.Free()
+	err := recovered(b.Free)
+	if !errors.Is(err, ErrDoubleFree) {
+		t.Fatal(err)
+	}
+
+	var se *StateError
+	if !errors.As(err, &se) {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"depth 0 of 2 slots", "peak 2", "free/", "Alloc(10) Alloc(20) Free(cap"} {
+		if !strings.Contains(se.State, s) {
+			t.Fatalf("%q not in %s", s, se.State)
+		}
+	}
+
+	b = NewStack(1)
+	if err := recovered(b.Free); errors.As(err, &se) {
+		t.Fatal(err)
+	}
+}
+
+func TestPanicVerbosity(t *testing.T) {
+	b := Make(WithSlots(2), WithPanicVerbosity(PanicSizes))
+	b.Alloc(10)
+	b.Alloc(20)
+	err := recovered(func() { b.Alloc(30) })
+	if !errors.Is(err, ErrExhausted) || !strings.Contains(err.Error(), "2 outstanding allocations (newest first): 20 10") {
+		t.Fatal(err)
+	}
+
+	b = Make(WithSlots(1), WithPanicVerbosity(PanicStacks))
+	b.Alloc(10)
+	err = recovered(func() { b.Alloc(30) })
+	if s := err.Error(); !strings.Contains(s, "#0, 10 bytes:") || !strings.Contains(s, "TestPanicVerbosity") || strings.Contains(s, "bufs.go") {
+		t.Fatal(err)
+	}
+}
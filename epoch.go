@@ -0,0 +1,142 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"sync/atomic"
+)
+
+// Shared is a read-mostly buffer, like a routing table serialized to bytes,
+// which is rebuilt occasionally and read constantly by many goroutines.
+// Every Install starts a new epoch. Readers Pin the buffer of the current
+// epoch and the buffers of past epochs are put back to the Allocator once
+// no reader pins them anymore. Readers never block and never observe a
+// buffer being modified.
+//
+//	g := s.Pin()
+//	lookup(g.Bytes())
+//	g.Unpin()
+//
+// The zero value of Shared is ready for use, using GCache and having no
+// buffer. A Shared is safe for concurrent use by multiple goroutines if its
+// Allocator is.
+type Shared struct {
+	// A is the Allocator the buffers are put back to. If nil, GCache is
+	// used. Set it before the first use.
+	A Allocator
+
+	cur atomic.Pointer[epoch]
+}
+
+type epoch struct {
+	b    []byte
+	a    Allocator
+	n    uint64       // Epoch number.
+	refs atomic.Int64 // Pins plus one while current. Zero once released.
+}
+
+func (e *epoch) unref() {
+	if e.refs.Add(-1) == 0 {
+		e.a.Put(e.b)
+		e.b = nil
+	}
+}
+
+func (s *Shared) allocator() Allocator {
+	if s.A == nil {
+		return &GCache
+	}
+
+	return s.A
+}
+
+// Guard is a pinned buffer of Shared. The zero Guard has no buffer.
+type Guard struct {
+	e *epoch
+}
+
+// Bytes returns the pinned buffer. It must not be modified and it's valid
+// until Unpin.
+func (g Guard) Bytes() []byte {
+	if g.e == nil {
+		return nil
+	}
+
+	return g.e.b
+}
+
+// Epoch returns the number of the epoch of the pinned buffer, zero if there's
+// none.
+func (g Guard) Epoch() uint64 {
+	if g.e == nil {
+		return 0
+	}
+
+	return g.e.n
+}
+
+// Unpin releases the buffer. It must be called exactly once for every Pin.
+func (g Guard) Unpin() {
+	if g.e != nil {
+		g.e.unref()
+	}
+}
+
+// Pin returns the buffer of the current epoch, protected from being put back
+// to the Allocator until Unpin.
+func (s *Shared) Pin() Guard {
+	for {
+		e := s.cur.Load()
+		if e == nil {
+			return Guard{}
+		}
+
+		if r := e.refs.Load(); r != 0 && e.refs.CompareAndSwap(r, r+1) {
+			return Guard{e}
+		}
+
+		// e was replaced and released meanwhile, the new epoch is
+		// current.
+	}
+}
+
+// Install makes b the buffer of a new epoch and returns its number. b must
+// have been obtained from the Allocator of s and it must not be modified
+// afterwards. The buffer of the previous epoch is put back to the Allocator
+// when its last reader unpins it.
+func (s *Shared) Install(b []byte) uint64 {
+	e := &epoch{b: b, a: s.allocator()}
+	e.refs.Store(1)
+	for {
+		old := s.cur.Load()
+		if old != nil {
+			e.n = old.n + 1
+		} else {
+			e.n = 1
+		}
+		if s.cur.CompareAndSwap(old, e) {
+			if old != nil {
+				old.unref()
+			}
+			return e.n
+		}
+	}
+}
+
+// Update installs a buffer of length n obtained from the Allocator of s,
+// filled by fill, see Install.
+func (s *Shared) Update(n int, fill func(b []byte)) uint64 {
+	b := s.allocator().Get(n)
+	fill(b)
+	return s.Install(b)
+}
+
+// Close ends the current epoch without starting a new one. Pin then returns
+// the zero Guard until the next Install.
+func (s *Shared) Close() {
+	if old := s.cur.Swap(nil); old != nil {
+		old.unref()
+	}
+}
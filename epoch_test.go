@@ -0,0 +1,77 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShared(t *testing.T) {
+	var c CCache
+	s := Shared{A: &c}
+	if g := s.Pin(); g.Bytes() != nil || g.Epoch() != 0 {
+		t.Fatal(g.Epoch())
+	}
+
+	s.Update(10, func(b []byte) { b[0] = 1 })
+	g := s.Pin()
+	s.Update(10, func(b []byte) { b[0] = 2 })
+	if n, _ := c.Stats(); n != 0 {
+		t.Fatal("pinned buffer released")
+	}
+
+	if g.Epoch() != 1 || g.Bytes()[0] != 1 {
+		t.Fatal(g.Epoch(), g.Bytes()[0])
+	}
+
+	g.Unpin()
+	if n, _ := c.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if g = s.Pin(); g.Epoch() != 2 || g.Bytes()[0] != 2 {
+		t.Fatal(g.Epoch(), g.Bytes()[0])
+	}
+
+	g.Unpin()
+	s.Close()
+	if n, _ := c.Stats(); n != 2 {
+		t.Fatal(n)
+	}
+}
+
+func TestSharedConcurrent(t *testing.T) {
+	var c CCache
+	s := Shared{A: &c}
+	s.Update(8, func(b []byte) { clear(b) })
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10000 {
+				g := s.Pin()
+				b := g.Bytes()
+				for _, v := range b[1:] {
+					if v != b[0] {
+						t.Error("torn read")
+						return
+					}
+				}
+				g.Unpin()
+			}
+		}()
+	}
+	for i := range 1000 {
+		s.Update(8, func(b []byte) {
+			for j := range b {
+				b[j] = byte(i)
+			}
+		})
+	}
+	wg.Wait()
+	s.Close()
+}
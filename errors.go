@@ -0,0 +1,70 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+)
+
+// Errors returned or carried by the panics of this package. Use errors.Is to
+// test for them, the actual errors are wrapped with more context.
+var (
+	// ErrExhausted reports there are no buffers (buffer slots) left.
+	ErrExhausted = errors.New("out of buffers")
+
+	// ErrInvalidSize reports a negative requested size, or a zero size not
+	// allowed by the ZeroAlloc option. Allocation methods not returning an
+	// error panic with it.
+	ErrInvalidSize = errors.New("invalid size")
+
+	// ErrTooLarge reports a request exceeding a configured limit.
+	ErrTooLarge = errors.New("request too large")
+
+	// ErrTimeout reports a request not satisfied in time.
+	ErrTimeout = errors.New("timeout")
+
+	// ErrClosed reports use of an already closed object.
+	ErrClosed = errors.New("already closed")
+
+	// ErrBorrowed reports freeing a buffer with outstanding borrows.
+	ErrBorrowed = errors.New("buffer has outstanding borrows")
+
+	// ErrOverlap reports freeing a buffer overlapping a retained one.
+	ErrOverlap = errors.New("buffer overlaps a retained buffer")
+
+	// ErrFrozen reports an allocation which is not allowed, see
+	// Stack.Freeze.
+	ErrFrozen = errors.New("allocation in frozen state")
+
+	// ErrDoubleFree reports freeing a buffer not allocated.
+	ErrDoubleFree = errors.New("free of a buffer not allocated")
+
+	// ErrModified reports a free buffer modified while retained for reuse,
+	// detected in checked mode.
+	ErrModified = errors.New("free buffer modified")
+
+	// ErrNotOwner reports use by a goroutine other than the owning one,
+	// see the CheckOwner option.
+	ErrNotOwner = errors.New("not the owning goroutine")
+
+	// ErrOrder reports freeing buffers of Stack out of order, see
+	// Stack.FreeBuf.
+	ErrOrder = errors.New("free out of order")
+
+	// ErrOverBudget reports an allocation exceeding the Budget option.
+	ErrOverBudget = errors.New("memory budget exceeded")
+
+	// ErrOverrun reports an allocated buffer written past its length, see
+	// the PoisonTail option.
+	ErrOverrun = errors.New("buffer written past its length")
+
+	// ErrForeign reports returning an object to a pool it was not obtained
+	// from, see BatchPool.Put.
+	ErrForeign = errors.New("object of another pool")
+
+	// ErrStarted reports configuring an object which is already in use, see
+	// Scanner.Split.
+	ErrStarted = errors.New("already started")
+)
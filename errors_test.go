@@ -0,0 +1,92 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func recovered(f func()) (err error) {
+	defer func() {
+		err, _ = recover().(error)
+	}()
+
+	f()
+	return nil
+}
+
+func TestErrors(t *testing.T) {
+	b := NewStack(1)
+	if err := recovered(func() { b.Alloc(1); b.Alloc(1) }); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+
+	b.Free()
+	if err := recovered(b.Free); !errors.Is(err, ErrDoubleFree) {
+		t.Fatal(err)
+	}
+
+	for _, f := range []func(){
+		func() { b.Alloc(-1) },
+		func() { b.AllocAligned(-1, 8) },
+		func() { new(Cache).Get(-1) },
+		func() { new(CCache).Cget(-1) },
+		func() { NewLFCache(16, 1).Get(-1) },
+		func() { b.AllocCap(-1, 8) },
+		func() { b.AllocInit(-1, 1, nil) },
+		func() { b.AllocLabeled(-1, "x") },
+		func() { b.AllocPinned(-1) },
+		func() { new(Cache).Cget(-1) },
+		func() { new(Cache).AllocVec(-1, 1) },
+		func() { new(Cache).AllocVec(1, -1) },
+		func() { new(CCache).Get(-1) },
+		func() { new(CCache).AllocVec(-1, 1) },
+		func() { NewLFCache(16, 1).Cget(-1) },
+		func() { NewShardedCache(1).Get(-1) },
+		func() { Compose(new(Cache), Heap{}).Get(-1) },
+		func() { Heap{}.Get(-1) },
+		func() { NewKeyedCache[int](0).Get(1, -1) },
+		func() { new(SyncPool).GetCap(-1) },
+		func() { new(SmallBuf).Alloc(-1) },
+		func() { NewRequestScope(Heap{}, 10).Alloc(-1) },
+		func() { NewLFCache(0, 1) },
+		func() { NewLFCache(16, -1) },
+	} {
+		if err := recovered(f); !errors.Is(err, ErrInvalidSize) {
+			t.Fatal(err)
+		}
+	}
+
+	c := Cache{make([]byte, 10)}
+	var cc CCache
+	cc.Put(make([]byte, 10))
+	lf := NewLFCache(16, 1)
+	lf.Put(lf.Get(16))
+	sc := NewShardedCache(1)
+	sc.Put(make([]byte, 10))
+	for _, a := range []TryAllocator{new(Cache), &c, new(CCache), &cc, lf, sc, Compose(&c, Heap{})} {
+		if err := recovered(func() { a.TryGet(-1) }); !errors.Is(err, ErrInvalidSize) {
+			t.Fatalf("%T %v", a, err)
+		}
+	}
+
+	if _, ok := cc.TryGet(10); !ok { // Would deadlock if TryGet(-1) left cc locked.
+		t.Fatal(ok)
+	}
+
+	if _, err := NewPool(1, nil).AllocTimeout(-1, 0); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	r := NewRing(nil, 0)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Buffers smaller than this can be allocated by the runtime inside a shared
+// block, which cannot have a finalizer.
+const minEscapeCap = 16
+
+// slotDebug holds the diagnostic data of an allocated slot.
+type slotDebug struct {
+	stack []byte // Stack of the Alloc call.
+}
+
+// escapes implements the escape detection mode of Stack.
+type escapes struct {
+	mu      sync.Mutex
+	id      uint64
+	retired map[uint64]escape // Freed buffers not yet garbage collected.
+}
+
+type escape struct {
+	size  int
+	stack []byte
+}
+
+func newEscapes() *escapes { return &escapes{retired: map[uint64]escape{}} }
+
+func (e *escapes) alloc(n int) ([]byte, *slotDebug) {
+	c := overCommit(n)
+	if c < minEscapeCap {
+		c = minEscapeCap
+	}
+	return make([]byte, n, c), &slotDebug{stack: debug.Stack()}
+}
+
+// retire arms a finalizer on the buffer of s, which the caller then drops.
+func (e *escapes) retire(s *slot) {
+	e.mu.Lock()
+	e.id++
+	id := e.id
+	e.retired[id] = escape{cap(s.b), s.dbg.stack}
+	e.mu.Unlock()
+	runtime.SetFinalizer(&s.b[:1][0], func(*byte) {
+		e.mu.Lock()
+		delete(e.retired, id)
+		e.mu.Unlock()
+	})
+	s.dbg = nil
+}
+
+// CheckEscapes reports buffers which are still referenced after being freed,
+// ie. buffers which escaped to the clients of Stack against the rules
+// documented at Alloc. Every report includes the stack of the Alloc call which
+// returned the buffer. CheckEscapes runs the garbage collector several times
+// and is intended for tests.
+//
+// CheckEscapes reports nothing unless the Stack was created with the
+// DetectEscapes option. In that mode Free never keeps the buffer for later
+// reuse: it arms a finalizer on it and drops it instead, making Alloc
+// allocate a new one. A buffer which is not finalized after being dropped is
+// still referenced by someone.
+func (p *Stack) CheckEscapes() (r []string) {
+	if p.esc == nil {
+		return nil
+	}
+
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond) // Let the finalizers run.
+	}
+
+	p.esc.mu.Lock()
+	defer p.esc.mu.Unlock()
+
+	var ids []uint64
+	for id := range p.esc.retired {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		v := p.esc.retired[id]
+		r = append(r, fmt.Sprintf("buffer of capacity %d referenced after Free, allocated at:\n%s", v.size, v.stack))
+	}
+	return r
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"strings"
+	"testing"
+)
+
+var escaped []byte
+
+func escapingAlloc(b *Stack) {
+	escaped = b.Alloc(42)
+	b.Free()
+}
+
+func TestCheckEscapes(t *testing.T) {
+	b := NewWithOptions(2, &Options{DetectEscapes: true})
+	for i := 0; i < 10; i++ {
+		b.Alloc(10)
+		b.Alloc(100)
+		b.Free()
+		b.Free()
+	}
+	if a := b.CheckEscapes(); len(a) != 0 {
+		t.Fatal(a)
+	}
+
+	escapingAlloc(&b)
+	a := b.CheckEscapes()
+	if g, e := len(a), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if !strings.Contains(a[0], "escapingAlloc") {
+		t.Fatal(a[0])
+	}
+
+	escaped = nil
+	if a := b.CheckEscapes(); len(a) != 0 {
+		t.Fatal(a)
+	}
+}
+
+func TestCheckEscapesBacking(t *testing.T) {
+	var c CCache
+	c.Put(make([]byte, 1000)[8:]) // Not the start of an allocation.
+	b := NewWithOptions(1, &Options{DetectEscapes: true, Backing: &c})
+	r := b.Alloc(10)
+	r = b.Grow(r, 500)
+	b.Free()
+	if a := b.CheckEscapes(); len(a) != 0 {
+		t.Fatal(a)
+	}
+
+	if n, bytes := c.Stats(); n != 1 || bytes != 992 {
+		t.Fatal("Backing used", n, bytes)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// inject counts an allocation and reports whether it's the one to fail, see
+// the FailEveryN option.
+func (p *Stack) inject() bool {
+	p.allocs++
+	return p.allocs%p.failN == 0
+}
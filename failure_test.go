@@ -0,0 +1,45 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailEveryN(t *testing.T) {
+	b := Make(WithSlots(4), WithFailEveryN(3))
+	for i := 1; i <= 6; i++ {
+		_, err := b.SafeAlloc(10)
+		if g, e := errors.Is(err, ErrExhausted), i%3 == 0; g != e {
+			t.Fatal(i, err)
+		}
+
+		if err == nil {
+			b.Free()
+		}
+	}
+
+	p := MakePool(WithSlots(4), WithFailEveryN(2))
+	for i := 1; i <= 4; i++ {
+		var r []byte
+		var err error
+		switch {
+		case i < 3:
+			r, err = p.AllocCtx(context.Background(), 10)
+		default:
+			r, err = p.AllocTimeout(10, time.Second)
+		}
+		if g, e := errors.Is(err, ErrExhausted), i%2 == 0; g != e {
+			t.Fatal(i, err)
+		}
+
+		if err == nil {
+			p.Free(r)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+)
+
+// The Weights option implements weighted fair queuing of the Pool waiters.
+// Every tag has a virtual time, advanced by 1/weight whenever a buffer is
+// handed over to a waiter of the tag. The waiter of the tag with the lowest
+// virtual time is served first, the waiters of a tag in FIFO order. A tag
+// starting to wait cannot claim the time it did not wait: its virtual time
+// is moved up to the virtual time of the last hand over.
+
+type tagKey struct{}
+
+// WithTag returns a copy of ctx carrying tag, identifying for example a
+// tenant. Pool.AllocCtx allocates on behalf of the tag, see the Weights
+// option.
+func WithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+func tagOf(ctx context.Context) string {
+	tag, _ := ctx.Value(tagKey{}).(string)
+	return tag
+}
+
+// activate prepares the virtual time of tag for a new waiter. It must be
+// called with p.mu held.
+func (p *Pool) activate(tag string) {
+	for _, w := range p.waiters {
+		if w.tag == tag {
+			return
+		}
+	}
+
+	p.vtimes[tag] = max(p.vtimes[tag], p.vclock)
+}
+
+// charge advances the virtual time of tag for a buffer handed over to it. It
+// must be called with p.mu held.
+func (p *Pool) charge(tag string) {
+	w, ok := p.weights[tag]
+	if !ok || w <= 0 {
+		w = 1
+	}
+	p.vclock = p.vtimes[tag]
+	p.vtimes[tag] += 1 / float64(w)
+}
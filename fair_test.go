@@ -0,0 +1,53 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeights(t *testing.T) {
+	p := NewPool(1, &Options{Weights: map[string]int{"a": 3}})
+	b, _ := p.AllocCtx(context.Background(), 10)
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, tag := range strings.Split("aaaaaabbbbbb", "") {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			b, err := p.AllocCtx(WithTag(context.Background(), tag), 10)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			order = append(order, tag)
+			mu.Unlock()
+			p.Free(b)
+		}()
+		for { // Make the order of the waiters deterministic.
+			p.mu.Lock()
+			n := len(p.waiters)
+			p.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}
+	p.Free(b)
+	wg.Wait()
+	if g, e := strings.Join(order, ""), "abaaabaabbbb"; g != e {
+		t.Fatal(g, e)
+	}
+}
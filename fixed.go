@@ -0,0 +1,86 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"io"
+)
+
+// FixedWriter is an io.Writer filling a buffer of fixed size, typically one
+// obtained from Alloc or Get, from the start. A write which does not fit in
+// the rest of the buffer writes nothing and fails with an error satisfying
+// errors.Is(err, ErrTooLarge), the buffer is never reallocated nor the data
+// truncated. It's meant for serializers computing the size of their output
+// beforehand, turning a wrong computation into an error.
+//
+// A FixedWriter is not safe for concurrent use by multiple goroutines.
+type FixedWriter struct {
+	buf []byte
+	n   int
+}
+
+var (
+	_ io.Writer       = (*FixedWriter)(nil)
+	_ io.StringWriter = (*FixedWriter)(nil)
+	_ io.ByteWriter   = (*FixedWriter)(nil)
+)
+
+// NewFixedWriter returns a FixedWriter writing to buf[:len(buf)].
+func NewFixedWriter(buf []byte) *FixedWriter { return &FixedWriter{buf: buf} }
+
+// Bytes returns the written part of the buffer.
+func (w *FixedWriter) Bytes() []byte { return w.buf[:w.n] }
+
+// Len returns the number of written bytes.
+func (w *FixedWriter) Len() int { return w.n }
+
+// Available returns the number of bytes which can still be written.
+func (w *FixedWriter) Available() int { return len(w.buf) - w.n }
+
+// Full reports whether the whole buffer has been written.
+func (w *FixedWriter) Full() bool { return w.n == len(w.buf) }
+
+// Reset discards the written data.
+func (w *FixedWriter) Reset() { w.n = 0 }
+
+func (w *FixedWriter) check(op string, n int) error {
+	if n > w.Available() {
+		return fmt.Errorf("FixedWriter.%s: writing %d bytes, %d available: %w", op, n, w.Available(), ErrTooLarge)
+	}
+
+	return nil
+}
+
+// Write implements io.Writer.
+func (w *FixedWriter) Write(p []byte) (int, error) {
+	if err := w.check("Write", len(p)); err != nil {
+		return 0, err
+	}
+
+	w.n += copy(w.buf[w.n:], p)
+	return len(p), nil
+}
+
+// WriteString implements io.StringWriter.
+func (w *FixedWriter) WriteString(s string) (int, error) {
+	if err := w.check("WriteString", len(s)); err != nil {
+		return 0, err
+	}
+
+	w.n += copy(w.buf[w.n:], s)
+	return len(s), nil
+}
+
+// WriteByte implements io.ByteWriter.
+func (w *FixedWriter) WriteByte(c byte) error {
+	if err := w.check("WriteByte", 1); err != nil {
+		return err
+	}
+
+	w.buf[w.n] = c
+	w.n++
+	return nil
+}
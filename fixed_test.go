@@ -0,0 +1,36 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFixedWriter(t *testing.T) {
+	b := NewStack(1)
+	w := NewFixedWriter(b.Alloc(8))
+	if _, err := fmt.Fprintf(w, "%d", 12345); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := w.WriteString("6789"); n != 0 || !errors.Is(err, ErrTooLarge) {
+		t.Fatal(n, err)
+	}
+
+	w.WriteString("67")
+	if err := w.WriteByte('8'); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteByte('9'); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if g, e := string(w.Bytes()), "12345678"; g != e || !w.Full() {
+		t.Fatal(g, e, w.Full())
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// Detach transfers the ownership of b, a buffer returned by AllocCtx and not
+// yet freed, from p to the caller. The pool stops counting b as allocated, so
+// another buffer can be allocated in its place, and forgets it: b must not be
+// freed to p, but it can be put to another cache or attached back by Attach.
+// A proxy hijacking a connection uses Detach to move the buffers of the
+// connection to the cache of the connection without copying them.
+func (p *Pool) Detach(b []byte) {
+	p.mu.Lock()
+	reclaimed := p.maxHold > 0 && p.isReclaimed(b)
+	p.writeOff(b)
+	if p.rec != nil {
+		p.rec.free(b)
+	}
+	p.detached++
+	p.mu.Unlock()
+	if !reclaimed { // Otherwise no longer counted.
+		p.free(nil)
+	}
+}
+
+// Attach transfers the ownership of b, a buffer not allocated from p, like
+// one obtained by Detach, to p. The pool retains b for reuse as if it was
+// freed, without counting it as allocated first. No other references to b's
+// backing array may exist. Buffers above the LargeThreshold option are not
+// retained. Zero capacity buffers are ignored.
+func (p *Pool) Attach(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.attach(b)
+	p.mu.Unlock()
+}
+
+// attach retains b. It must be called with p.mu held.
+func (p *Pool) attach(b []byte) {
+	if p.large > 0 && cap(b) > p.large {
+		return
+	}
+
+	if p.checked {
+		p.check(b)
+		p.sums[addr(b)] = checksum(b)
+	}
+	p.cache(b)
+	p.attached++
+}
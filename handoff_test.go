@@ -0,0 +1,37 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDetachAttach(t *testing.T) {
+	p := NewPool(1, &Options{Checked: true})
+	ctx := context.Background()
+	b, err := p.AllocCtx(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Detach(b)
+	// The slot is available again.
+	c, err := p.AllocCtx(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Free(c)
+	p.Attach(b)
+	m := p.Metrics()
+	if m.InUse != 0 || m.Retained != 2 || m.Detached != 1 || m.Attached != 1 {
+		t.Fatalf("%+v", m)
+	}
+
+	if err := recovered(func() { p.Attach(b) }); err == nil {
+		t.Fatal("attached twice")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"hash"
+	"io"
+)
+
+// MaxSumSize is the size of the SumBuf array. It's enough for the hashes of
+// the standard library, including SHA-512.
+const MaxSumSize = 64
+
+// SumBuf is storage for the result of hash.Hash.Sum. Being an array, it can
+// live on the stack or be embedded in a struct, so computing a checksum
+// using it allocates nothing.
+//
+//	var s bufs.SumBuf
+//	sum := s.Sum(h)
+type SumBuf [MaxSumSize]byte
+
+// Sum returns the checksum of h stored in s. The result is valid until the
+// next use of s. If h.Size() exceeds MaxSumSize, the result is allocated.
+func (s *SumBuf) Sum(h hash.Hash) []byte { return h.Sum(s[:0]) }
+
+// HashBlockSize is the default size of the staging buffers of HashCopy.
+const HashBlockSize = 32 << 10
+
+// HashCopy writes the data read from r to h until EOF, staging them in a
+// buffer obtained from a, and returns the number of bytes written. The
+// buffer length is HashBlockSize rounded up to a multiple of h.BlockSize(),
+// so h processes full blocks without copying them to its internal buffer.
+// If a is nil, GCache is used.
+func HashCopy(h hash.Hash, r io.Reader, a Allocator) (n int64, err error) {
+	if a == nil {
+		a = &GCache
+	}
+	bs := max(h.BlockSize(), 1)
+	b := a.Get((HashBlockSize + bs - 1) / bs * bs)
+	defer a.Put(b)
+
+	for {
+		m, err := io.ReadFull(r, b)
+		h.Write(b[:m])
+		n += int64(m)
+		switch err {
+		case nil:
+			// ok
+		case io.EOF, io.ErrUnexpectedEOF:
+			return n, nil
+		default:
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	var c Cache
+	h := sha512.New()
+	n, err := HashCopy(h, bytes.NewReader(data), &c)
+	if err != nil || n != int64(len(data)) {
+		t.Fatal(n, err)
+	}
+
+	var s SumBuf
+	if g, e := s.Sum(h), sha512.Sum512(data); !bytes.Equal(g, e[:]) {
+		t.Fatalf("%x %x", g, e)
+	}
+
+	if g, e := len(c), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if raceEnabled {
+		t.Skip("allocations not reliable with the race detector")
+	}
+
+	h = sha256.New()
+	if g := testing.AllocsPerRun(100, func() {
+		h.Reset()
+		h.Write(data[:100])
+		s.Sum(h)
+	}); g != 0 {
+		t.Fatal(g)
+	}
+}
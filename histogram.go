@@ -0,0 +1,107 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Histogram is a distribution of requested buffer sizes: size -> number of
+// requests. The zero value is not usable, use make(Histogram).
+type Histogram map[int]int
+
+// Observe records a request of size n.
+func (h Histogram) Observe(n int) { h[n]++ }
+
+// LogHistogram returns the Histogram of the allocation sizes of a log written
+// by a Pool having the Record option set.
+func LogHistogram(log io.Reader) (Histogram, error) {
+	h := Histogram{}
+	r := bufio.NewReader(log)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			return h, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		arg, err := binary.ReadUvarint(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("LogHistogram: %w", err)
+		}
+
+		switch op {
+		case recAlloc:
+			h.Observe(int(arg))
+		case recFree:
+			// nop
+		default:
+			return nil, fmt.Errorf("LogHistogram: invalid record op %#x", op)
+		}
+	}
+}
+
+// split returns n buffer sizes distributed proportionally to h, using the
+// largest remainder method.
+func (h Histogram) split(n int) (r []int) {
+	total := 0
+	sizes := make([]int, 0, len(h))
+	for size, count := range h {
+		if count > 0 {
+			sizes = append(sizes, size)
+			total += count
+		}
+	}
+	if total == 0 || n <= 0 {
+		return nil
+	}
+
+	slices.Sort(sizes)
+	type rem struct{ size, frac int }
+	var rems []rem
+	for _, size := range sizes {
+		k := n * h[size] / total
+		for range k {
+			r = append(r, size)
+		}
+		rems = append(rems, rem{size, n * h[size] % total})
+	}
+	slices.SortStableFunc(rems, func(a, b rem) int { return b.frac - a.frac })
+	for _, v := range rems[:n-len(r)] {
+		r = append(r, v.size)
+	}
+	return r
+}
+
+// PrewarmFromHistogram puts n newly allocated buffers into c, their sizes
+// distributed proportionally to h. A restarted program can then reach the
+// steady state hit rate of a previous run immediately, see LogHistogram.
+func (c *CCache) PrewarmFromHistogram(h Histogram, n int) {
+	for _, size := range h.split(n) {
+		c.Put(make([]byte, size, overCommit(size)))
+	}
+}
+
+// PrewarmFromHistogram fills p with newly allocated free buffers, one for every
+// buffer p allows to be allocated at the same time, their sizes distributed
+// proportionally to h. See CCache.PrewarmFromHistogram.
+func (p *Pool) PrewarmFromHistogram(h Histogram) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, size := range h.split(p.n - len(p.c)) {
+		p.cache(p.makeBuf(size, overCommit(size)))
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := Histogram{10: 5, 100: 3, 1000: 2}
+	if g, e := fmt.Sprint(h.split(5)), "[10 10 100 1000 10]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	var log bytes.Buffer
+	p := NewPool(2, &Options{Record: &log})
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 10)
+	b, _ := p.AllocCtx(ctx, 10)
+	p.Free(a)
+	p.Free(b)
+	a, _ = p.AllocCtx(ctx, 1000)
+	p.Free(a)
+	h, err := LogHistogram(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(h), "map[10:2 1000:1]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	q := NewPool(3, nil)
+	q.PrewarmFromHistogram(h)
+	if n, bytes := q.Stats(); n != 3 || bytes != int64(2*overCommit(10)+overCommit(1000)) {
+		t.Fatal(n, bytes)
+	}
+
+	var c CCache
+	c.PrewarmFromHistogram(h, 6)
+	if n, _ := c.Stats(); n != 6 {
+		t.Fatal(n)
+	}
+}
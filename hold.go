@@ -0,0 +1,76 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// hold arms the MaxHold timer of b. It must be called with p.mu held.
+func (p *Pool) hold(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	a := addr(b)
+	var t Timer
+	t = afterFunc(p.clock, p.maxHold, func() {
+		p.mu.Lock()
+		if p.held[a] != t { // Freed in the meantime.
+			p.mu.Unlock()
+			return
+		}
+
+		delete(p.held, a)
+		note := p.note(b)
+		p.writeOff(b)
+		p.reclaimed[&b[:1][0]] = struct{}{}
+		p.reclN++
+		p.reclB += uint64(cap(b))
+		p.mu.Unlock()
+		p.free(nil)
+		p.emit(Event{Kind: EventReclaimed, Time: p.clock.Now(), Note: note})
+	})
+	p.held[a] = t
+}
+
+// unhold disarms the MaxHold timer of b, the buffer being freed, and reports
+// whether the pool already reclaimed it, in which case b must not be freed.
+// It must be called with p.mu held.
+func (p *Pool) unhold(b []byte) (reclaimed bool) {
+	if cap(b) == 0 {
+		return false
+	}
+
+	if t := p.held[addr(b)]; t != nil {
+		t.Stop()
+		delete(p.held, addr(b))
+		return false
+	}
+
+	k := &b[:1][0]
+	if _, ok := p.reclaimed[k]; ok {
+		delete(p.reclaimed, k)
+		return true
+	}
+
+	return false
+}
+
+// isReclaimed reports whether b was reclaimed because of the MaxHold option.
+// It must be called with p.mu held.
+func (p *Pool) isReclaimed(b []byte) bool {
+	if cap(b) == 0 || p.reclaimed == nil {
+		return false
+	}
+
+	_, ok := p.reclaimed[&b[:1][0]]
+	return ok
+}
+
+// Reclaimed reports the number and combined capacity of the buffers reclaimed
+// because of the MaxHold option.
+func (p *Pool) Reclaimed() (n, bytes uint64) {
+	p.mu.Lock()
+	n, bytes = p.reclN, p.reclB
+	p.mu.Unlock()
+	return n, bytes
+}
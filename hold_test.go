@@ -0,0 +1,46 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaxHold(t *testing.T) {
+	events := make(chan EventKind, 1)
+	p := NewPool(1, &Options{
+		MaxHold: 100 * time.Millisecond,
+		Hook:    HookFunc(func(e Event) { events <- e.Kind }),
+	})
+	a, _ := p.AllocCtx(context.Background(), 10)
+	if g, e := <-events, EventReclaimed; g != e {
+		t.Fatal(g, e)
+	}
+
+	b, err := p.AllocTimeout(10, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Free(a)
+	if n, _ := p.Stats(); n != 0 {
+		t.Fatal(n)
+	}
+
+	p.Free(b)
+	if n, _ := p.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, bytes := p.Reclaimed(); n != 1 || bytes != 20 {
+		t.Fatal(n, bytes)
+	}
+
+	if m := p.Metrics(); m.InUse != 0 {
+		t.Fatalf("%+v", m)
+	}
+}
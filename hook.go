@@ -0,0 +1,60 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+// Values of EventKind.
+const (
+	_ EventKind = iota
+
+	// EventSaturated is reported when all buffers of a Pool have been in
+	// use for longer than the SaturationThreshold option while some
+	// caller has to wait for a buffer.
+	EventSaturated
+
+	// EventRelieved is reported when a buffer of a saturated Pool becomes
+	// available again.
+	EventRelieved
+
+	// EventHeldTooLong is reported when a buffer of a Pool is not freed
+	// within the Watchdog option after its allocation.
+	EventHeldTooLong
+
+	// EventWrittenOff is reported when a buffer lent by Pool.Loan is not
+	// given back before its deadline.
+	EventWrittenOff
+
+	// EventReclaimed is reported when a buffer of a Pool is not freed
+	// within the MaxHold option after its allocation.
+	EventReclaimed
+)
+
+// Event is a notable state change of a pool reported to a Hook.
+type Event struct {
+	Kind  EventKind
+	Time  time.Time // Per the Clock option.
+	Stack []byte    // EventHeldTooLong only: stack of the allocation.
+	Note  any       // The note of the buffer concerned, if any, see Pool.SetNote.
+}
+
+// Hook receives pool Events. Events are reported synchronously by the
+// goroutine causing them, but never while holding a lock of the pool.
+// EventHeldTooLong, EventWrittenOff and EventReclaimed are reported by a
+// goroutine of their own.
+type Hook interface {
+	Event(Event)
+}
+
+// HookFunc adapts an ordinary function to Hook.
+type HookFunc func(Event)
+
+// Event implements Hook.
+func (f HookFunc) Event(e Event) { f(e) }
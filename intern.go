@@ -0,0 +1,125 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sync"
+)
+
+// Interner is a content addressable cache of small byte strings. Identical
+// contents share one buffer, obtained from a CCache, which is retained while
+// referenced.
+//
+// An Interner is safe for concurrent use by multiple goroutines.
+type Interner struct {
+	mu         sync.Mutex
+	bytes      int64 // Combined length of the interned buffers.
+	c          *CCache
+	m          map[uint64][]*internEntry
+	maxBytes   int64
+	maxEntries int
+	n          int // Number of interned buffers.
+	seed       maphash.Seed
+}
+
+type internEntry struct {
+	b    []byte // The interned content, capacity limited to its length.
+	buf  []byte // The buffer obtained from the CCache, put back by Release.
+	refs int
+}
+
+// NewInterner returns a newly created Interner holding at most maxEntries
+// buffers of combined length at most maxBytes, obtained from c. If c is nil,
+// GCache is used.
+func NewInterner(c *CCache, maxEntries, maxBytes int) *Interner {
+	if c == nil {
+		c = &GCache
+	}
+	return &Interner{
+		c:          c,
+		m:          map[uint64][]*internEntry{},
+		maxBytes:   int64(maxBytes),
+		maxEntries: maxEntries,
+		seed:       maphash.MakeSeed(),
+	}
+}
+
+// Intern returns a buffer with the same content as b, shared by all callers
+// interning the same content, and increments its reference count. The result
+// must not be modified and must be released by Release. If the limits of the
+// Interner would be exceeded, or if b is empty, Intern returns b, which Release
+// ignores.
+func (in *Interner) Intern(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+
+	h := maphash.Bytes(in.seed, b)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for _, e := range in.m[h] {
+		if bytes.Equal(e.b, b) {
+			e.refs++
+			return e.b
+		}
+	}
+
+	if in.n+1 > in.maxEntries || in.bytes+int64(len(b)) > in.maxBytes {
+		return b
+	}
+
+	buf := in.c.Get(len(b))
+	r := buf[:copy(buf, b):len(b)]
+	in.m[h] = append(in.m[h], &internEntry{b: r, buf: buf, refs: 1})
+	in.n++
+	in.bytes += int64(len(b))
+	return r
+}
+
+// Release decrements the reference count of b, a result of Intern. The
+// buffer is returned to the CCache when the count reaches zero.
+func (in *Interner) Release(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	h := maphash.Bytes(in.seed, b)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	a := in.m[h]
+	for i, e := range a {
+		if cap(e.b) == 0 || &e.b[:1][0] != &b[:1][0] {
+			continue
+		}
+
+		if e.refs--; e.refs != 0 {
+			return
+		}
+
+		a[i] = a[len(a)-1]
+		a[len(a)-1] = nil
+		if a = a[:len(a)-1]; len(a) == 0 {
+			delete(in.m, h)
+		} else {
+			in.m[h] = a
+		}
+		in.n--
+		in.bytes -= int64(len(e.b))
+		in.c.Put(e.buf)
+		return
+	}
+}
+
+// Stats reports the number of interned buffers and their combined length.
+func (in *Interner) Stats() (n int, bytes int64) {
+	in.mu.Lock()
+	n, bytes = in.n, in.bytes
+	in.mu.Unlock()
+	return n, bytes
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestInterner(t *testing.T) {
+	var c CCache
+	in := NewInterner(&c, 2, 10)
+	a := in.Intern([]byte("foo"))
+	b := in.Intern([]byte("foo"))
+	if &a[0] != &b[0] {
+		t.Fatal("content not shared")
+	}
+
+	d := in.Intern([]byte("bar"))
+	if n, bytes := in.Stats(); n != 2 || bytes != 6 {
+		t.Fatal(n, bytes)
+	}
+
+	src := []byte("baz")
+	if e := in.Intern(src); &e[0] != &src[0] {
+		t.Fatal("limit not enforced")
+	}
+
+	in.Release(src)
+	in.Release(a)
+	if n, _ := in.Stats(); n != 2 {
+		t.Fatal(n)
+	}
+
+	in.Release(b)
+	in.Release(d)
+	if n, bytes := in.Stats(); n != 0 || bytes != 0 {
+		t.Fatal(n, bytes)
+	}
+
+	if n, _ := c.Stats(); n == 0 {
+		t.Fatal("buffers not returned to the cache")
+	}
+}
+
+func TestInternerCapacity(t *testing.T) {
+	var c CCache
+	c.Put(make([]byte, 100))
+	in := NewInterner(&c, 1, 10)
+	in.Release(in.Intern([]byte("foo")))
+	if n, bytes := c.Stats(); n != 1 || bytes != 100 {
+		t.Fatal(n, bytes)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// KeyedCache retains at most one buffer per key, for example per connection
+// or per table, so reusing buffers per entity does not require a Cache field
+// in every entity. When the number of retained buffers exceeds the configured
+// maximum, the least recently put one is dropped.
+//
+// A KeyedCache is safe for concurrent use by multiple goroutines.
+type KeyedCache[K comparable] struct {
+	mu    sync.Mutex
+	bytes int64     // Combined capacity of the retained buffers.
+	lru   list.List // Front: most recently put.
+	m     map[K]*list.Element
+	max   int
+}
+
+type keyedEntry[K comparable] struct {
+	key K
+	b   []byte
+}
+
+// NewKeyedCache returns a newly created KeyedCache retaining at most max
+// buffers.
+func NewKeyedCache[K comparable](max int) *KeyedCache[K] {
+	return &KeyedCache[K]{m: map[K]*list.Element{}, max: max}
+}
+
+// Get returns a buffer of length n. If a buffer is retained for key, it's
+// removed from the cache and returned if its capacity is sufficient.
+// Otherwise Get returns a newly allocated buffer.
+//
+// NOTE: The buffer returned by Get _is not guaranteed_ to be zeroed.
+func (c *KeyedCache[K]) Get(key K, n int) []byte {
+	checkSize("KeyedCache.Get", n)
+	c.mu.Lock()
+	el := c.m[key]
+	if el != nil {
+		c.remove(el)
+	}
+	c.mu.Unlock()
+	if el != nil {
+		if b := el.Value.(*keyedEntry[K]).b; cap(b) >= n {
+			return b[:n]
+		}
+	}
+
+	return make([]byte, n, overCommit(n))
+}
+
+// Put retains b for key, replacing the buffer retained for key before, if
+// any. No other references to b's backing array may exist.
+func (c *KeyedCache[K]) Put(key K, b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el := c.m[key]; el != nil {
+		e := el.Value.(*keyedEntry[K])
+		c.bytes += int64(cap(b) - cap(e.b))
+		e.b = b
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.m[key] = c.lru.PushFront(&keyedEntry[K]{key, b})
+	c.bytes += int64(cap(b))
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes el from c. It must be called with c.mu held.
+func (c *KeyedCache[K]) remove(el *list.Element) {
+	e := el.Value.(*keyedEntry[K])
+	delete(c.m, e.key)
+	c.lru.Remove(el)
+	c.bytes -= int64(cap(e.b))
+}
+
+// Stats reports memory consumed by a KeyedCache, without accounting for some
+// (smallish) additional overhead. 'n' is the number of retained buffers, bytes
+// is their combined capacity. The statistics are maintained incrementally,
+// Stats takes constant time.
+func (c *KeyedCache[K]) Stats() (n int, bytes int64) {
+	c.mu.Lock()
+	n, bytes = c.lru.Len(), c.bytes
+	c.mu.Unlock()
+	return n, bytes
+}
@@ -0,0 +1,39 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestKeyedCache(t *testing.T) {
+	c := NewKeyedCache[string](2)
+	a := c.Get("a", 10)
+	c.Put("a", a)
+	if b := c.Get("b", 10); &b[0] == &a[0] {
+		t.Fatal("buffer of another key returned")
+	}
+
+	if b := c.Get("a", 5); &b[0] != &a[0] {
+		t.Fatal("retained buffer not returned")
+	}
+
+	c.Put("a", a)
+	c.Put("b", make([]byte, 20))
+	c.Put("c", make([]byte, 30)) // Evicts "a".
+	if n, bytes := c.Stats(); n != 2 || bytes != 50 {
+		t.Fatal(n, bytes)
+	}
+
+	if b := c.Get("a", 5); &b[0] == &a[0] {
+		t.Fatal("evicted buffer returned")
+	}
+
+	c.Put("b", make([]byte, 40)) // Replaces the 20 bytes one.
+	c.Get("c", 1)
+	if n, bytes := c.Stats(); n != 1 || bytes != 40 {
+		t.Fatal(n, bytes)
+	}
+}
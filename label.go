@@ -0,0 +1,52 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AllocLabeled is like Alloc, but the allocation is labeled by label, which
+// must not be empty. FreeLabel then frees all the allocations made under the
+// same label at once. A logical operation allocating buffers in several
+// helpers can label them instead of pairing every Alloc with a Free.
+func (p *Stack) AllocLabeled(n int, label string) []byte {
+	if label == "" {
+		panic(errors.New("Stack.AllocLabeled: empty label"))
+	}
+
+	d := p.Depth()
+	r := p.Alloc(n)
+	if p.Depth() != d { // Not a zero length allocation without a slot.
+		p.top().label = label
+	}
+	return r
+}
+
+// FreeLabel frees all not yet freed allocations labeled by label and returns
+// their number. The allocations must be the most recent ones, ie. all
+// allocations made after the first one labeled by label must have the same
+// label. Otherwise FreeLabel frees nothing and panics with an error
+// satisfying errors.Is(err, ErrOrder).
+func (p *Stack) FreeLabel(label string) (n int) {
+	allocated := p.s[len(p.s):cap(p.s)] // Most recent first.
+	for i := len(allocated) - 1; i >= 0; i-- {
+		if allocated[i].label != label {
+			continue
+		}
+
+		for _, v := range allocated[:i] {
+			if v.label != label {
+				p.fail(fmt.Errorf("Stack.FreeLabel: %q: an allocation labeled %q is more recent: %w", label, v.label, ErrOrder))
+			}
+		}
+		for range i + 1 {
+			p.Free()
+		}
+		return i + 1
+	}
+	return 0
+}
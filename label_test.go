@@ -0,0 +1,47 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFreeLabel(t *testing.T) {
+	b := NewStack(8)
+	b.Alloc(1)
+	for range 3 {
+		b.AllocLabeled(10, "op")
+	}
+	if g, e := b.FreeLabel("op"), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Depth(), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g := b.FreeLabel("op"); g != 0 {
+		t.Fatal(g)
+	}
+
+	b.AllocLabeled(10, "op")
+	b.Alloc(10)
+	if err := recovered(func() { b.FreeLabel("op") }); !errors.Is(err, ErrOrder) {
+		t.Fatal(err)
+	}
+
+	if g, e := b.Depth(), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	// Free forgets the label of the slot.
+	b.Free()
+	b.Free()
+	b.Alloc(10)
+	if g := b.FreeLabel("op"); g != 0 {
+		t.Fatal(g)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// profileLabelKey is the pprof label key set to the Name option.
+const profileLabelKey = "bufs"
+
+func newLabels(o *Options) *pprof.LabelSet {
+	if !o.ProfileLabels {
+		return nil
+	}
+
+	ls := pprof.Labels(profileLabelKey, o.Name)
+	return &ls
+}
+
+// makeBuf returns make([]byte, n, c). If labels is not nil, the allocation is
+// made with the pprof labels set.
+func makeBuf(labels *pprof.LabelSet, n, c int) (r []byte) {
+	if labels == nil {
+		return make([]byte, n, c)
+	}
+
+	pprof.Do(context.Background(), *labels, func(context.Context) { r = make([]byte, n, c) })
+	return r
+}
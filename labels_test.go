@@ -0,0 +1,32 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProfileLabels(t *testing.T) {
+	o := &Options{Name: "test", ProfileLabels: true}
+	b := NewWithOptions(1, o)
+	if g, e := len(b.Alloc(10)), 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Free()
+	p := NewPool(1, o)
+	for _, n := range []int{10, 5, 100} {
+		r, err := p.AllocCtx(context.Background(), n)
+		if err != nil || len(r) != n {
+			t.Fatal(n, len(r), err)
+		}
+
+		p.Free(r)
+	}
+	if n, bytes := p.Stats(); n != 1 || bytes != 200 {
+		t.Fatal(n, bytes)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+)
+
+// LFCache is a lock-free cache of fixed size buffers, safe for concurrent use
+// by multiple goroutines. Unlike CCache, no method of LFCache ever blocks on a
+// mutex, which makes it suitable for latency critical code and for finalizers,
+// where waiting for a lock held by some other goroutine is unacceptable.
+//
+// The cached buffers are kept in a fixed array of slots which are taken and
+// filled using atomic swap and compare-and-swap. There are no linked nodes,
+// so Put never allocates and the ABA problem of CAS based stacks cannot
+// occur.
+//
+// NOTE: Stack, Cache and all other types not documented otherwise are not
+// safe for concurrent use and must not be used from finalizers of objects
+// shared with other goroutines.
+//
+// Under the race detector, the ownership of a buffer is transferred from Put
+// to the Get returning it, but LFCache does not otherwise synchronize its
+// users. Accesses to a buffer made after putting it are reported as races.
+//
+// See Cache for the handling of zero length requests and buffers.
+type LFCache struct {
+	size  int
+	slots []unsafe.Pointer // *byte: first byte of a cached buffer of capacity size.
+	hint  uint32           // Slot of the last successful Put, scans start here.
+
+	transN atomic.Uint64 // Number of Gets exceeding size, see TransientStats.
+	transB atomic.Uint64 // Combined length of the Gets exceeding size.
+}
+
+// NewLFCache returns a newly created LFCache retaining up to n buffers of
+// capacity size. It panics with ErrInvalidSize if size is not positive or if
+// n is negative.
+func NewLFCache(size, n int) *LFCache {
+	if size <= 0 || n < 0 {
+		panic(fmt.Errorf("NewLFCache: size %d, %d buffers: %w", size, n, ErrInvalidSize))
+	}
+
+	return &LFCache{size: size, slots: make([]unsafe.Pointer, n)}
+}
+
+// Get returns a buffer ([]byte) of length n. Requests for up to the size of
+// the cache are served from the cache if possible. All other requests and
+// requests made while the cache is empty are served by newly allocated
+// buffers.
+//
+// NOTE: The buffer returned by Get _is not guaranteed_ to be zeroed.
+func (c *LFCache) Get(n int) []byte {
+	checkSize("LFCache.Get", n)
+	if n == 0 {
+		return []byte{}
+	}
+
+	if n > c.size {
+		c.transN.Add(1)
+		c.transB.Add(uint64(n))
+		return make([]byte, n)
+	}
+
+	if r, ok := c.TryGet(n); ok {
+		return r
+	}
+
+	return make([]byte, n, c.size)
+}
+
+// Cget will acquire a buffer using Get and then clears it to zeros. The
+// zeroing goes up to n, not cap(r).
+func (c *LFCache) Cget(n int) (r []byte) {
+	r = c.Get(n)
+	for i := range r {
+		r[i] = 0
+	}
+	return
+}
+
+// TryGet is like Get, but it only returns a cached buffer. If n exceeds the
+// buffer size of the cache or no buffer is cached, TryGet reports false.
+func (c *LFCache) TryGet(n int) ([]byte, bool) {
+	checkSize("LFCache.TryGet", n)
+	if n == 0 {
+		return []byte{}, true
+	}
+
+	if n > c.size {
+		return nil, false
+	}
+
+	raceDisable()
+	if i := c.start(); i >= 0 {
+		for j := 0; j < len(c.slots); j++ {
+			p := &c.slots[(i+j)%len(c.slots)]
+			if atomic.LoadPointer(p) == nil {
+				continue
+			}
+
+			if q := atomic.SwapPointer(p, nil); q != nil {
+				raceEnable()
+				raceAcquire(q)
+				return unsafe.Slice((*byte)(q), c.size)[:n], true
+			}
+		}
+	}
+	raceEnable()
+	return nil, false
+}
+
+// Put caches b for possible later reuse (via Get). Buffers of capacity other
+// than the size of the cache and buffers put while the cache is full are
+// discarded. No other references to b's backing array may exist.
+func (c *LFCache) Put(b []byte) {
+	if cap(b) != c.size {
+		return
+	}
+
+	q := unsafe.Pointer(&b[:1][0])
+	raceReleaseMerge(q)
+	raceDisable()
+	defer raceEnable()
+
+	if i := c.start(); i >= 0 {
+		for j := 0; j < len(c.slots); j++ {
+			k := (i + j) % len(c.slots)
+			if atomic.CompareAndSwapPointer(&c.slots[k], nil, q) {
+				atomic.StoreUint32(&c.hint, uint32(k))
+				return
+			}
+		}
+	}
+}
+
+// TransientStats reports the number and combined length of the buffers
+// returned by Get which exceeded the buffer size of the cache. Such buffers
+// are never retained and are not included in Stats.
+func (c *LFCache) TransientStats() (n, bytes uint64) {
+	return c.transN.Load(), c.transB.Load()
+}
+
+// Stats reports memory consumed by an LFCache, without accounting for some
+// (smallish) additional overhead. 'n' is the number of cached buffers, bytes
+// is their combined capacity. The result is only approximate while the cache
+// is being used concurrently.
+func (c *LFCache) Stats() (n int, bytes int64) {
+	for i := range c.slots {
+		if atomic.LoadPointer(&c.slots[i]) != nil {
+			n++
+		}
+	}
+	return n, int64(n) * int64(c.size)
+}
+
+func (c *LFCache) start() int {
+	if len(c.slots) == 0 {
+		return -1
+	}
+
+	return int(atomic.LoadUint32(&c.hint) % uint32(len(c.slots)))
+}
@@ -0,0 +1,99 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestLFCache(t *testing.T) {
+	c := NewLFCache(16, 2)
+	a, b, x := c.Get(10), c.Get(16), c.Get(17)
+	if g, e := len(a), 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	c.Put(a)
+	c.Put(b)
+	c.Put(x)
+	if n, bytes := c.Stats(); n != 2 || bytes != 32 {
+		t.Fatal(n, bytes)
+	}
+
+	if g, e := &c.Get(1)[:1][0], &b[0]; g != e && g != &a[0] {
+		t.Fatal("cached buffer not reused")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b := c.Get(j % 17)
+				for i := range b {
+					b[i] = byte(j)
+				}
+				c.Put(b)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func benchmarkConcurrent(b *testing.B, get func(int) []byte, put func([]byte)) {
+	b.SetBytes(bufSize)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			put(get(bufSize))
+		}
+	})
+}
+
+func BenchmarkCCacheParallel(b *testing.B) {
+	var c CCache
+	benchmarkConcurrent(b, c.Get, c.Put)
+}
+
+func BenchmarkLFCacheParallel(b *testing.B) {
+	c := NewLFCache(bufSize, 64)
+	benchmarkConcurrent(b, c.Get, c.Put)
+}
+
+func TestLFCacheTransientStats(t *testing.T) {
+	c := NewLFCache(16, 1)
+	c.Put(c.Get(16))
+	c.Get(100)
+	c.Get(200)
+	if n, bytes := c.TransientStats(); n != 2 || bytes != 300 {
+		t.Fatal(n, bytes)
+	}
+}
+
+func TestLFCacheRace(t *testing.T) {
+	// Under the race detector, the write of the getter must be ordered
+	// after the write of the putter only by the ownership transfer of Put
+	// and Get.
+	c := NewLFCache(16, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			if b, ok := c.TryGet(16); ok {
+				b[0] = 2
+				return
+			}
+
+			runtime.Gosched()
+		}
+	}()
+	b := c.Get(16)
+	b[0] = 1
+	c.Put(b)
+	<-done
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"time"
+)
+
+// Loan is like AllocCtx, but the buffer is lent to code the caller does not
+// fully trust, for example a plugin. The borrower must give the buffer back
+// by calling giveBack before deadline. If it does not, the pool writes the
+// buffer off: it stops counting it as allocated, so another buffer can be
+// allocated in its place, never reuses it and reports EventWrittenOff. A
+// misbehaving borrower then cannot permanently shrink the pool.
+//
+// giveBack frees the buffer and reports true, or reports false if the buffer
+// was already written off or reclaimed because of the MaxHold option, in
+// which case it does nothing. Calling giveBack more than once reports false.
+// The deadline is measured by the Clock option, see TimerClock.
+func (p *Pool) Loan(ctx context.Context, n int, deadline time.Time) (b []byte, giveBack func() bool, err error) {
+	if b, err = p.AllocCtx(ctx, n); err != nil {
+		return nil, nil, err
+	}
+
+	done := false // Protected by p.mu.
+	t := afterFunc(p.clock, deadline.Sub(p.clock.Now()), func() {
+		p.mu.Lock()
+		if done || p.isReclaimed(b) {
+			p.mu.Unlock()
+			return
+		}
+
+		done = true
+		note := p.note(b)
+		p.writeOff(b)
+		p.offN++
+		p.offB += uint64(cap(b))
+		p.mu.Unlock()
+		p.free(nil)
+		p.emit(Event{Kind: EventWrittenOff, Time: p.clock.Now(), Note: note})
+	})
+	return b, func() bool {
+		p.mu.Lock()
+		if done {
+			p.mu.Unlock()
+			return false
+		}
+
+		done = true
+		if p.isReclaimed(b) {
+			p.unhold(b) // Forget the reclaimed buffer.
+			p.mu.Unlock()
+			t.Stop()
+			return false
+		}
+
+		p.mu.Unlock()
+		t.Stop()
+		p.Free(b)
+		return true
+	}, nil
+}
+
+// writeOff forgets the allocated buffer b. It must be called with p.mu held.
+func (p *Pool) writeOff(b []byte) {
+	if p.watchdog > 0 {
+		p.unwatch(b)
+	}
+	if p.maxHold > 0 {
+		p.unhold(b)
+	}
+	if p.large > 0 {
+		delete(p.larges, addr(b))
+	}
+	p.forget(b)
+}
+
+// WrittenOff reports the number and combined capacity of the buffers written
+// off by Loan.
+func (p *Pool) WrittenOff() (n, bytes uint64) {
+	p.mu.Lock()
+	n, bytes = p.offN, p.offB
+	p.mu.Unlock()
+	return n, bytes
+}
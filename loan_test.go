@@ -0,0 +1,151 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoan(t *testing.T) {
+	events := make(chan EventKind, 1)
+	p := NewPool(1, &Options{Hook: HookFunc(func(e Event) { events <- e.Kind })})
+	ctx := context.Background()
+	_, giveBack, err := p.Loan(ctx, 10, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !giveBack() || giveBack() {
+		t.Fatal("giveBack")
+	}
+
+	_, giveBack, err = p.Loan(ctx, 10, time.Now().Add(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := <-events, EventWrittenOff; g != e {
+		t.Fatal(g, e)
+	}
+
+	if _, err := p.AllocTimeout(10, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if giveBack() {
+		t.Fatal("giveBack")
+	}
+
+	if n, bytes := p.WrittenOff(); n != 1 || bytes != 20 {
+		t.Fatal(n, bytes)
+	}
+}
+
+// timerClock is a TimerClock firing its timers when advanced.
+type timerClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*clockTimer
+}
+
+type clockTimer struct {
+	c  *timerClock
+	at time.Time
+	f  func()
+}
+
+func (c *timerClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *timerClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &clockTimer{c, c.now.Add(d), f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *clockTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	n := len(t.c.timers)
+	t.c.timers = slices.DeleteFunc(t.c.timers, func(u *clockTimer) bool { return u == t })
+	return len(t.c.timers) != n
+}
+
+func (c *timerClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*clockTimer
+	c.timers = slices.DeleteFunc(c.timers, func(t *clockTimer) bool {
+		if !t.at.After(c.now) {
+			due = append(due, t)
+			return true
+		}
+
+		return false
+	})
+	c.mu.Unlock()
+	for _, t := range due {
+		t.f()
+	}
+}
+
+func TestLoanMaxHold(t *testing.T) {
+	clock := &timerClock{now: time.Unix(1e9, 0)}
+	p := NewPool(1, &Options{Clock: clock, MaxHold: time.Minute})
+	ctx := context.Background()
+	_, giveBack, err := p.Loan(ctx, 10, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(time.Minute)
+	if n, _ := p.Reclaimed(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if giveBack() {
+		t.Fatal("giveBack of a reclaimed buffer")
+	}
+
+	clock.advance(time.Hour)
+	if n, _ := p.WrittenOff(); n != 0 {
+		t.Fatal(n)
+	}
+
+	if len(p.reclaimed) != 0 || len(clock.timers) != 0 {
+		t.Fatal(len(p.reclaimed), len(clock.timers))
+	}
+
+	// The deadline is measured by the clock, not by wall time.
+	_, giveBack, err = p.Loan(ctx, 10, clock.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(time.Second)
+	if n, _ := p.WrittenOff(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if giveBack() {
+		t.Fatal("giveBack of a written off buffer")
+	}
+
+	if _, err := p.AllocTimeout(10, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// PoolMetrics is a snapshot of the metrics of a Pool, see Pool.Metrics.
+//
+// The cumulative counters are 64-bit on all platforms and they wrap around on
+// overflow. Use Since or Delta to compute their increments, which are correct
+// across a wrap around, instead of subtracting the values.
+type PoolMetrics struct {
+	Retained       int    // Number of free buffers retained, as by Stats.
+	RetainedBytes  int64  // Combined capacity of the retained buffers.
+	InUse          int    // Number of allocated buffers.
+	Waiting        int    // Number of allocations waiting for a buffer.
+	Hits           uint64 // Allocations served by a retained buffer, cumulative.
+	Misses         uint64 // Allocations served by a new buffer, cumulative.
+	Transient      uint64 // Buffers not retained by Free, cumulative, see TransientStats.
+	TransientBytes uint64 // Their combined capacity, cumulative.
+	Detached       uint64 // Buffers given away by Detach, cumulative.
+	Attached       uint64 // Buffers retained by Attach, cumulative.
+}
+
+// Since returns m with the cumulative counters replaced by their increments
+// since prev, an older snapshot of the same pool. The other fields are those
+// of m. Dividing the increments by the time between the snapshots gives the
+// rates.
+func (m PoolMetrics) Since(prev PoolMetrics) PoolMetrics {
+	m.Hits = Delta(prev.Hits, m.Hits)
+	m.Misses = Delta(prev.Misses, m.Misses)
+	m.Transient = Delta(prev.Transient, m.Transient)
+	m.TransientBytes = Delta(prev.TransientBytes, m.TransientBytes)
+	m.Detached = Delta(prev.Detached, m.Detached)
+	m.Attached = Delta(prev.Attached, m.Attached)
+	return m
+}
+
+// Delta returns the increment of a cumulative counter from prev to cur. The
+// result is correct also when the counter wrapped around in between, provided
+// it did so at most once.
+func Delta(prev, cur uint64) uint64 { return cur - prev }
+
+// Metrics returns a consistent snapshot of the metrics of p, in constant
+// time. It's meant to be called by the callbacks of metric systems, for
+// example by an OpenTelemetry callback registered for asynchronous
+// instruments:
+//
+//	retained, _ := meter.Int64ObservableGauge("bufs.retained_bytes")
+//	hits, _ := meter.Int64ObservableCounter("bufs.hits")
+//	meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+//		m := pool.Metrics()
+//		o.ObserveInt64(retained, m.RetainedBytes)
+//		o.ObserveInt64(hits, int64(m.Hits))
+//		return nil
+//	}, retained, hits)
+func (p *Pool) Metrics() PoolMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolMetrics{
+		Retained:       p.cachedN,
+		RetainedBytes:  p.cachedB,
+		InUse:          p.used,
+		Waiting:        len(p.waiters),
+		Hits:           p.hits,
+		Misses:         p.misses,
+		Transient:      p.transN,
+		TransientBytes: p.transB,
+		Detached:       p.detached,
+		Attached:       p.attached,
+	}
+}
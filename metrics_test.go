@@ -0,0 +1,34 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPoolMetrics(t *testing.T) {
+	p := NewPool(2, nil)
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 10)
+	p.Free(a)
+	a, _ = p.AllocCtx(ctx, 10)  // Hit.
+	b, _ := p.AllocCtx(ctx, 10) // Miss.
+	p.Free(b)
+	if g, e := p.Metrics(), (PoolMetrics{Retained: 1, RetainedBytes: 20, InUse: 1, Hits: 1, Misses: 2}); g != e {
+		t.Fatalf("%+v %+v", g, e)
+	}
+
+	p.Free(a)
+}
+
+func TestPoolMetricsSince(t *testing.T) {
+	prev := PoolMetrics{Hits: math.MaxUint64 - 1, Misses: 5, Transient: 1}
+	m := PoolMetrics{InUse: 3, Hits: 2, Misses: 7, Transient: 1}
+	if g, e := m.Since(prev), (PoolMetrics{InUse: 3, Hits: 4, Misses: 2}); g != e {
+		t.Fatalf("%+v %+v", g, e)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !race
+
+package bufs
+
+import (
+	"unsafe"
+)
+
+const raceEnabled = false
+
+func raceAcquire(unsafe.Pointer)      {}
+func raceReleaseMerge(unsafe.Pointer) {}
+func raceDisable()                    {}
+func raceEnable()                     {}
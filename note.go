@@ -0,0 +1,68 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SetNote attaches note, for example a request ID, to buf, a buffer allocated
+// from p and not yet freed. The note is shown by Verify and by the state
+// summary of the PanicState option, so diagnostics tell who holds a buffer.
+// Free forgets the note.
+func (p *Stack) SetNote(buf []byte, note any) {
+	s := p.owner(buf)
+	if s == nil {
+		p.fail(errors.New("Stack.SetNote: buffer not allocated"))
+	}
+
+	s.note = note
+}
+
+// notes returns the notes of the allocated slots, most recent first.
+func (p *Stack) notes() string {
+	var a []string
+	for _, v := range p.s[len(p.s):cap(p.s)] {
+		if v.note != nil {
+			a = append(a, fmt.Sprint(v.note))
+		}
+	}
+	return strings.Join(a, ", ")
+}
+
+// SetNote attaches note, for example a request ID, to buf, a buffer returned
+// by AllocCtx and not yet freed. The note is reported in Event.Note of the
+// events concerning the buffer, like EventHeldTooLong, so diagnostics tell
+// who holds the buffer. Free forgets the note.
+func (p *Pool) SetNote(buf []byte, note any) {
+	if cap(buf) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	if p.notes == nil {
+		p.notes = map[uintptr]any{}
+	}
+	p.notes[addr(buf)] = note
+	p.mu.Unlock()
+}
+
+// note returns the note of b. It must be called with p.mu held.
+func (p *Pool) note(b []byte) any {
+	if cap(b) == 0 {
+		return nil
+	}
+
+	return p.notes[addr(b)]
+}
+
+// forget forgets the note of b. It must be called with p.mu held.
+func (p *Pool) forget(b []byte) {
+	if p.notes != nil && cap(b) != 0 {
+		delete(p.notes, addr(b))
+	}
+}
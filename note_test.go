@@ -0,0 +1,37 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetNote(t *testing.T) {
+	b := NewStack(2)
+	x := b.Alloc(10)
+	b.SetNote(x, "request id=42")
+	if err := b.Verify(2); err == nil || !strings.Contains(err.Error(), "request id=42") {
+		t.Fatal(err)
+	}
+
+	b.Free()
+	b.Alloc(10)
+	if err := b.Verify(2); err == nil || strings.Contains(err.Error(), "request id=42") {
+		t.Fatal(err)
+	}
+
+	events := make(chan Event, 1)
+	p := NewPool(1, &Options{Watchdog: 50 * time.Millisecond, Hook: HookFunc(func(e Event) { events <- e })})
+	y, _ := p.AllocCtx(context.Background(), 10)
+	p.SetNote(y, 42)
+	if e := <-events; e.Kind != EventHeldTooLong || e.Note != 42 {
+		t.Fatalf("%+v", e)
+	}
+
+	p.Free(y)
+}
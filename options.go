@@ -0,0 +1,415 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Clock reports the current time to the time based features of this package.
+// Its purpose is to make those features testable deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// TimerClock is a Clock which also runs the timers of the time based
+// features of Pool: the deadlines of Loan and the MaxHold and Watchdog
+// options. If the Clock option does not implement TimerClock, those timers
+// run on wall time.
+type TimerClock interface {
+	Clock
+
+	// AfterFunc calls f once d elapsed, like time.AfterFunc. f is called
+	// by a goroutine of its own or by the one advancing the clock, never by
+	// the caller of AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer of a TimerClock. Stop prevents the timer from firing,
+// like time.Timer.Stop.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// afterFunc schedules f by c, if it's a TimerClock, or on wall time.
+func afterFunc(c Clock, d time.Duration, f func()) Timer {
+	if tc, ok := c.(TimerClock); ok {
+		return tc.AfterFunc(d, f)
+	}
+
+	return time.AfterFunc(d, f)
+}
+
+// Options amend the behavior of a Stack created by NewWithOptions and of
+// Pools created by NewPool. The zero value of Options is equivalent to using
+// New. Options not applicable to a particular type are ignored.
+type Options struct {
+	// Slots is the number of buffer slots of Stack, or the maximum
+	// number of allocated buffers of a Pool, created by Make and MakePool.
+	// NewWithOptions and NewPool take the number as an argument instead.
+	Slots int
+
+	// Policy is the slot replacement policy, see SetPolicy.
+	Policy Policy
+
+	// SoftLimit and OnEvict are passed to SetSoftLimit.
+	SoftLimit int
+	OnEvict   func(evicted int)
+
+	// TTL, if positive, is the time a free buffer is retained for before
+	// it's dropped by Free or Trim.
+	TTL time.Duration
+
+	// SizeEWMA, if positive, is the weight, at most 1, of the newest
+	// request in the exponentially weighted moving average of the
+	// request sizes served by every slot of Stack. Trim, and Free if TTL
+	// is set, then reallocate the free buffers more than twice as big as
+	// Alloc would allocate for the average, so a noisy workload does not
+	// make Stack retain whatever the last big request left behind.
+	SizeEWMA float64
+
+	// Clock is the source of time for TTL, SaturationThreshold and
+	// Sampler. If it implements TimerClock, it also runs the timers of
+	// Loan, MaxHold, Watchdog and periodic sampling. If nil, the system
+	// clock is used.
+	Clock Clock
+
+	// Name is the name of the pool. It's used to label profiles, see
+	// ProfileLabels.
+	Name string
+
+	// ProfileLabels, if set, makes the pool allocate new buffers with the
+	// pprof label "bufs" set to Name, see runtime/pprof.Do. CPU profiles
+	// then attribute the cost of allocating and zeroing the buffers to the
+	// logical pool instead of to this package. The heap profiles of the Go
+	// runtime do not record labels.
+	ProfileLabels bool
+
+	// Checked turns on the checked mode, which verifies the correct use of
+	// the pool at the cost of some overhead. See Borrow.
+	Checked bool
+
+	// PanicState, if set, makes Stack panic with a *StateError carrying
+	// a summary of their state, including the most recent operations, so
+	// the panic output alone is enough for a postmortem.
+	PanicState bool
+
+	// PanicVerbosity selects what the panics of Stack reporting
+	// ErrExhausted tell about the outstanding allocations.
+	PanicVerbosity PanicVerbosity
+
+	// Hook, if not nil, receives the events of a Pool.
+	Hook Hook
+
+	// Reserve is the number of buffers of a Pool which can be allocated
+	// only by Foreground allocations, see WithPriority.
+	Reserve int
+
+	// SaturationThreshold is how long all buffers of a Pool must be in use
+	// before EventSaturated is reported.
+	SaturationThreshold time.Duration
+
+	// ZeroAlloc is the handling of Alloc(0) by Stack. The default,
+	// ZeroAllocSlot, returns a zero length slice aliasing a retained
+	// buffer.
+	ZeroAlloc ZeroAlloc
+
+	// LargeThreshold, if positive, makes Stack.Alloc and Pool.AllocCtx
+	// serve requests for more than LargeThreshold bytes by newly allocated
+	// buffers which are dropped by Free instead of being retained. Rare
+	// huge requests then do not replace the retained buffers. See
+	// TransientStats.
+	LargeThreshold int
+
+	// MaxHold, if positive, is the maximum time a buffer of a Pool can be
+	// allocated for. A buffer held longer is reclaimed: the pool stops
+	// counting it as allocated, so another buffer can be allocated in its
+	// place, reports EventReclaimed and drops the buffer when it's freed
+	// eventually, instead of retaining it. The holder can keep using the
+	// buffer. A pool then heals itself from stalled consumers. See
+	// Reclaimed.
+	MaxHold time.Duration
+
+	// Weights, if not nil, makes a Pool hand freed buffers over to the
+	// waiting allocations of different tags, see WithTag, in proportion
+	// to the weights of the tags, instead of in FIFO order. A tenant
+	// allocating often then cannot starve the others. Tags not in Weights
+	// have weight 1. Priorities take precedence over the weights.
+	Weights map[string]int
+
+	// Watchdog, if positive, makes a Pool report EventHeldTooLong for
+	// every buffer not freed within Watchdog after its allocation. It's a
+	// diagnostic tool, the stack of every allocation is captured.
+	Watchdog time.Duration
+
+	// Record, if not nil, makes a Pool write a log of its allocations and
+	// frees to Record, see Replay. The writes happen while holding the
+	// lock of the pool, Record should be buffered. Write errors stop the
+	// recording.
+	Record io.Writer
+
+	// DetectEscapes turns on the escape detection mode, see CheckEscapes.
+	// It's a diagnostic tool, Stack does not reuse any buffers in this
+	// mode, nor obtain them from the Backing option.
+	DetectEscapes bool
+
+	// Budget, if positive, is the maximum combined capacity of the
+	// buffers held by Stack, allocated and free. An allocation which
+	// would exceed it first sheds all free buffers, reporting them to
+	// OnEvict, then calls OnPressure and if the budget is still exceeded,
+	// it panics with an error satisfying errors.Is(err, ErrOverBudget).
+	//
+	// The Go runtime treats running out of memory as a fatal error, Budget
+	// is the way to degrade gracefully before that happens.
+	Budget int
+
+	// OnPressure, if not nil, is called with the number of bytes an
+	// allocation would exceed Budget by after shedding the free buffers.
+	// The application can use it to shed load.
+	OnPressure func(need int)
+
+	// CheckOwner, if set, makes Stack record the goroutine using it
+	// first and panic, with an error satisfying errors.Is(err,
+	// ErrNotOwner), when Alloc, Free, Append or Grow is called by another
+	// goroutine. Stack is not safe for concurrent use and sharing it
+	// by accident corrupts it in ways hard to trace back. It's a
+	// diagnostic tool, identifying the goroutine is slow. See Disown.
+	CheckOwner bool
+
+	// StrictOrder, if set, makes Stack record the call site of every
+	// allocation, which Stack.FreeBuf reports when buffers are freed
+	// out of order. It's a diagnostic tool, recording the call sites is
+	// slow.
+	StrictOrder bool
+
+	// Backing, if not nil, makes Stack obtain its buffers from Backing
+	// instead of allocating them, and put every buffer it stops retaining
+	// back to it, including the free ones on Close. A CCache used as the
+	// Backing of several Stacks then holds a single memory budget shared
+	// by the stack style and get/put style call sites. Backing is not used
+	// in the DetectEscapes mode.
+	Backing Allocator
+
+	// FailEveryN, if positive, makes every FailEveryN-th allocation fail as
+	// if the Stack or the Pool was exhausted: Stack.Alloc panics and
+	// Pool.AllocCtx returns, without waiting, an error satisfying
+	// errors.Is(err, ErrExhausted). It's meant for tests of the fallback
+	// paths of the code using the pool.
+	FailEveryN int
+
+	// PoisonTail, if set, makes Stack fill the capacity of every
+	// allocated buffer past its length with PoisonByte, so code reading
+	// past the length, by reslicing within the capacity, sees poison
+	// instead of stale data which happens to work. Free panics, with an
+	// error satisfying errors.Is(err, ErrOverrun), if the tail was
+	// written. AllocCap, Append and Grow extend the length the buffer may
+	// be written up to. It's a diagnostic tool, the poisoning is slow.
+	PoisonTail bool
+
+	// MinAlignment, if bigger than 1, is the minimal alignment, a power of
+	// 2, of the buffers returned by Stack: the address of their first
+	// byte is a multiple of MinAlignment, see Alignment. Stack
+	// over-allocates by up to MinAlignment-1 bytes to guarantee it.
+	MinAlignment int
+
+	// TouchPages, if set, makes Stack and Pool write to every memory page
+	// of the backing arrays they create, for example in Alloc or
+	// PrewarmFromHistogram. Fresh memory obtained from the operating
+	// system then page faults right away instead of on its first use,
+	// moving the cost off latency critical paths which write to the
+	// buffers later. Buffers obtained from the Backing option are not
+	// touched.
+	TouchPages bool
+
+	// Trace, if set, makes Stack emit runtime/trace log events for Alloc
+	// and Free, including the buffer sizes, and user regions spanning the
+	// lifetime of every allocation, provided tracing is enabled. The
+	// regions must end on the goroutine they started on, ie. Alloc and the
+	// matching Free must be called by the same goroutine.
+	Trace bool
+}
+
+// NewWithOptions is like New but the returned Stack is configured by o.
+// Passing a nil o is the same as calling New.
+func NewWithOptions(n int, o *Options) Stack {
+	b := NewStack(n)
+	if o == nil {
+		return b
+	}
+
+	b.policy = o.Policy
+	b.ttl = o.TTL
+	b.ewma = min(o.SizeEWMA, 1)
+	b.clock = o.Clock
+	if b.clock == nil {
+		b.clock = systemClock{}
+	}
+	b.labels = newLabels(o)
+	b.trace = o.Trace
+	b.checked = o.Checked
+	b.large = o.LargeThreshold
+	b.zero = o.ZeroAlloc
+	b.budget = o.Budget
+	b.onPressure = o.OnPressure
+	b.owned = o.CheckOwner
+	b.backing = o.Backing
+	b.strict = o.StrictOrder
+	if o.PanicState {
+		b.ops = &opLog{}
+	}
+	b.verbosity = o.PanicVerbosity
+	b.failN = o.FailEveryN
+	b.poison = o.PoisonTail
+	b.touch = o.TouchPages
+	if a := o.MinAlignment; a > 1 {
+		if a&(a-1) != 0 {
+			panic(fmt.Errorf("NewWithOptions: MinAlignment %d is not a power of 2: %w", a, ErrInvalidSize))
+		}
+
+		b.minAlign = a
+	}
+	if o.DetectEscapes {
+		b.esc = newEscapes()
+	}
+	if o.Checked || o.DetectEscapes {
+		b.transitions = map[SlotState]uint64{}
+	}
+	b.SetSoftLimit(o.SoftLimit, o.OnEvict)
+	return b
+}
+
+// Option sets a field of Options. Make and MakePool take a list of Options,
+// which keeps the construction of pools stable as new features add new
+// fields: an Option not used by a program does not appear in its code.
+type Option func(*Options)
+
+// NewOptions returns Options configured by opts, applied in order.
+func NewOptions(opts ...Option) *Options {
+	o := &Options{}
+	for _, f := range opts {
+		f(o)
+	}
+	return o
+}
+
+// Make returns a Stack configured by opts, applied in order. It's equivalent
+// to NewWithOptions(o.Slots, o), where o is NewOptions(opts...).
+func Make(opts ...Option) Stack {
+	o := NewOptions(opts...)
+	return NewWithOptions(o.Slots, o)
+}
+
+// MakePool returns a Pool configured by opts, applied in order. It's
+// equivalent to NewPool(o.Slots, o), where o is NewOptions(opts...).
+func MakePool(opts ...Option) *Pool {
+	o := NewOptions(opts...)
+	return NewPool(o.Slots, o)
+}
+
+// WithSlots sets Options.Slots.
+func WithSlots(n int) Option { return func(o *Options) { o.Slots = n } }
+
+// WithPolicy sets Options.Policy.
+func WithPolicy(p Policy) Option { return func(o *Options) { o.Policy = p } }
+
+// WithSoftLimit sets Options.SoftLimit and Options.OnEvict.
+func WithSoftLimit(limit int, onEvict func(evicted int)) Option {
+	return func(o *Options) { o.SoftLimit, o.OnEvict = limit, onEvict }
+}
+
+// WithMaxBytes sets Options.Budget and Options.OnPressure.
+func WithMaxBytes(budget int, onPressure func(need int)) Option {
+	return func(o *Options) { o.Budget, o.OnPressure = budget, onPressure }
+}
+
+// WithTTL sets Options.TTL.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// WithSizeEWMA sets Options.SizeEWMA.
+func WithSizeEWMA(weight float64) Option { return func(o *Options) { o.SizeEWMA = weight } }
+
+// WithClock sets Options.Clock.
+func WithClock(c Clock) Option { return func(o *Options) { o.Clock = c } }
+
+// WithName sets Options.Name. If profileLabels is true, Options.ProfileLabels
+// is set as well.
+func WithName(name string, profileLabels bool) Option {
+	return func(o *Options) { o.Name, o.ProfileLabels = name, profileLabels }
+}
+
+// WithChecked sets Options.Checked.
+func WithChecked() Option { return func(o *Options) { o.Checked = true } }
+
+// WithPanicState sets Options.PanicState.
+func WithPanicState() Option { return func(o *Options) { o.PanicState = true } }
+
+// WithPanicVerbosity sets Options.PanicVerbosity.
+func WithPanicVerbosity(v PanicVerbosity) Option {
+	return func(o *Options) { o.PanicVerbosity = v }
+}
+
+// WithHook sets Options.Hook.
+func WithHook(h Hook) Option { return func(o *Options) { o.Hook = h } }
+
+// WithReserve sets Options.Reserve.
+func WithReserve(n int) Option { return func(o *Options) { o.Reserve = n } }
+
+// WithSaturationThreshold sets Options.SaturationThreshold.
+func WithSaturationThreshold(d time.Duration) Option {
+	return func(o *Options) { o.SaturationThreshold = d }
+}
+
+// WithZeroAlloc sets Options.ZeroAlloc.
+func WithZeroAlloc(z ZeroAlloc) Option { return func(o *Options) { o.ZeroAlloc = z } }
+
+// WithLargeThreshold sets Options.LargeThreshold.
+func WithLargeThreshold(n int) Option { return func(o *Options) { o.LargeThreshold = n } }
+
+// WithWatchdog sets Options.Watchdog.
+func WithWatchdog(d time.Duration) Option { return func(o *Options) { o.Watchdog = d } }
+
+// WithRecord sets Options.Record.
+func WithRecord(w io.Writer) Option { return func(o *Options) { o.Record = w } }
+
+// WithDetectEscapes sets Options.DetectEscapes.
+func WithDetectEscapes() Option { return func(o *Options) { o.DetectEscapes = true } }
+
+// WithCheckOwner sets Options.CheckOwner.
+func WithCheckOwner() Option { return func(o *Options) { o.CheckOwner = true } }
+
+// WithMaxHold sets Options.MaxHold.
+func WithMaxHold(d time.Duration) Option { return func(o *Options) { o.MaxHold = d } }
+
+// WithWeights sets Options.Weights.
+func WithWeights(w map[string]int) Option { return func(o *Options) { o.Weights = w } }
+
+// WithStrictOrder sets Options.StrictOrder.
+func WithStrictOrder() Option { return func(o *Options) { o.StrictOrder = true } }
+
+// WithBacking sets Options.Backing.
+func WithBacking(a Allocator) Option { return func(o *Options) { o.Backing = a } }
+
+// WithFailEveryN sets Options.FailEveryN.
+func WithFailEveryN(n int) Option { return func(o *Options) { o.FailEveryN = n } }
+
+// WithPoisonTail sets Options.PoisonTail.
+func WithPoisonTail() Option { return func(o *Options) { o.PoisonTail = true } }
+
+// WithMinAlignment sets Options.MinAlignment.
+func WithMinAlignment(n int) Option { return func(o *Options) { o.MinAlignment = n } }
+
+// WithTouchPages sets Options.TouchPages.
+func WithTouchPages() Option { return func(o *Options) { o.TouchPages = true } }
+
+// WithTrace sets Options.Trace.
+func WithTrace() Option { return func(o *Options) { o.Trace = true } }
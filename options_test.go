@@ -0,0 +1,55 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestTTL(t *testing.T) {
+	clock := &testClock{t: time.Unix(1e9, 0)}
+	b := NewWithOptions(2, &Options{TTL: time.Minute, Clock: clock})
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Free()
+	clock.advance(time.Minute)
+	b.Free()
+	if g, e := b.Stats(), int64(60); g != e {
+		t.Fatal(g, e)
+	}
+
+	clock.advance(time.Second)
+	b.Trim()
+	if g, e := b.Stats(), int64(20); g != e {
+		t.Fatal(g, e)
+	}
+
+	clock.advance(time.Minute)
+	b.Trim()
+	if g, e := b.Stats(), int64(0); g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestMake(t *testing.T) {
+	b := Make(WithSlots(3), WithPolicy(LRU), WithMaxBytes(1000, nil), WithChecked())
+	if b.Remaining() != 3 || b.policy != LRU || b.budget != 1000 || !b.checked {
+		t.Fatal(b.Remaining(), b.policy, b.budget, b.checked)
+	}
+
+	p := MakePool(WithSlots(2), WithReserve(1))
+	if p.n != 2 || p.reserve != 1 {
+		t.Fatal(p.n, p.reserve)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FreeBuf is like Free, but it verifies b is the buffer Free would free, ie.
+// a buffer returned by the lastly made and not yet freed allocation, possibly
+// resliced. Otherwise FreeBuf panics with an error satisfying errors.Is(err,
+// ErrOrder). With the StrictOrder option, the error names the call sites of
+// the allocations of both the expected and the freed buffer.
+//
+// Code freeing several buffers can use FreeBuf to document the required
+// reverse order and get a descriptive error instead of a later corruption
+// when the order is wrong.
+func (p *Stack) FreeBuf(b []byte) {
+	if len(p.s) != cap(p.s) && cap(b) != 0 {
+		if top := p.top(); !contains(top.b, b) {
+			p.fail(p.orderError(top, b))
+		}
+	}
+	p.Free()
+}
+
+func (p *Stack) orderError(top *slot, b []byte) error {
+	if !p.strict {
+		return fmt.Errorf("Stack.FreeBuf: %w", ErrOrder)
+	}
+
+	freed := "not allocated"
+	if s := p.owner(b); s != nil {
+		freed = "allocated at " + s.allocSite
+	}
+	return fmt.Errorf("Stack.FreeBuf: expected the buffer allocated at %s, freed buffer %s: %w", top.allocSite, freed, ErrOrder)
+}
+
+// pkgDir is the directory of the package sources.
+var pkgDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// allocSite returns the position of the nearest caller outside of this
+// package.
+func allocSite() string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		f, more := frames.Next()
+		if filepath.Dir(f.File) != pkgDir || strings.HasSuffix(f.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+
+		if !more {
+			return "?"
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFreeBuf(t *testing.T) {
+	b := NewWithOptions(2, &Options{StrictOrder: true})
+	x := b.Alloc(10)
+	y := b.Alloc(10)
+	err := recovered(func() { b.FreeBuf(x) })
+	if !errors.Is(err, ErrOrder) || strings.Count(err.Error(), "order_test.go:") != 2 {
+		t.Fatal(err)
+	}
+
+	b.FreeBuf(y[2:])
+	b.FreeBuf(x)
+	if g, e := b.Depth(), 0; g != e {
+		t.Fatal(g, e)
+	}
+
+	b = NewStack(1)
+	b.Alloc(10)
+	if err := recovered(func() { b.FreeBuf(make([]byte, 10)) }); !errors.Is(err, ErrOrder) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// goid returns the ID of the current goroutine, parsed from the header of its
+// stack trace. It's slow, use it only in debug modes.
+func goid() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	n, _ := strconv.ParseUint(string(b), 10, 64)
+	return n
+}
+
+// checkOwner panics if op is used by a goroutine other than the one which
+// used the Stack first, see the CheckOwner option.
+func (p *Stack) checkOwner(op string) {
+	id := goid()
+	if p.ownerID == 0 {
+		p.ownerID = id
+		return
+	}
+
+	if id != p.ownerID {
+		p.fail(fmt.Errorf("Stack.%s: used by goroutine %d, owned by goroutine %d: %w", op, id, p.ownerID, ErrNotOwner))
+	}
+}
+
+// Disown makes the next use of the Stack record the goroutine using it
+// as the new owner, see the CheckOwner option. Call it when handing the
+// Stack over to another goroutine.
+func (p *Stack) Disown() { p.ownerID = 0 }
@@ -0,0 +1,63 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckOwner(t *testing.T) {
+	b := NewWithOptions(2, &Options{CheckOwner: true})
+	b.Alloc(10)
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		err = recovered(func() { b.Alloc(10) })
+	}()
+	<-done
+	if !errors.Is(err, ErrNotOwner) {
+		t.Fatal(err)
+	}
+
+	b.Free()
+	b.Disown()
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+
+		err = recovered(func() { b.Alloc(10); b.Free() })
+	}()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckOwnerEntryPoints(t *testing.T) {
+	b := NewWithOptions(2, &Options{CheckOwner: true})
+	b.Alloc(10)
+	b.Free()
+	b.AllocInit(10, 1, func([]byte) {})
+	b.Free()
+	for _, f := range []func(){
+		func() { b.AllocAligned(10, 16) },
+		func() { b.AllocInit(10, 1, func([]byte) {}) }, // The reuse path.
+	} {
+		var err error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			err = recovered(f)
+		}()
+		<-done
+		if !errors.Is(err, ErrNotOwner) {
+			t.Fatal(err)
+		}
+	}
+}
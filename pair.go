@@ -0,0 +1,91 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pair is a pair of correlated buffers allocated by Pool.AllocPair, like the
+// input and output of a compressor.
+type Pair struct {
+	Src []byte
+	Dst []byte
+
+	p *Pool
+}
+
+// AllocPair allocates the buffers of a Pair: Src of length srcLen and Dst of
+// length dstSizer(srcLen), for example the maximal compressed length of
+// srcLen bytes. If dstSizer is nil, Dst has length srcLen. Both buffers are
+// allocated or AllocPair waits, so goroutines allocating pairs concurrently
+// from a small pool do not deadlock each holding half of a pair. AllocPair
+// returns ctx.Err() if ctx is done before both buffers are allocated. If
+// the pool can never hold both buffers at once, because it allows fewer than
+// two buffers to be allocated with the priority of ctx, AllocPair fails
+// immediately with an error satisfying errors.Is(err, ErrTooLarge).
+//
+// Release frees both buffers at once.
+func (p *Pool) AllocPair(ctx context.Context, srcLen int, dstSizer func(int) int) (*Pair, error) {
+	dstLen := srcLen
+	if dstSizer != nil {
+		dstLen = dstSizer(srcLen)
+	}
+	if srcLen < 0 || dstLen < 0 {
+		return nil, fmt.Errorf("Pool.AllocPair: size %d/%d: %w", srcLen, dstLen, ErrInvalidSize)
+	}
+
+	if n := p.limit(priorityOf(ctx)); n < 2 {
+		return nil, fmt.Errorf("Pool.AllocPair: pool allows %d buffer(s): %w", n, ErrTooLarge)
+	}
+
+	// Pairs are allocated one at a time. A pair waiting for its second
+	// buffer then waits only for buffers which are going to be freed.
+	select {
+	case p.pairs <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.pairs }()
+
+	src, err := p.AllocCtx(ctx, srcLen)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := p.AllocCtx(ctx, dstLen)
+	if err != nil {
+		p.Free(src)
+		return nil, err
+	}
+
+	return &Pair{src, dst, p}, nil
+}
+
+// Release frees both buffers of x. n is the number of bytes of Dst produced
+// from Src, for example the compressed length, recorded by PairStats. x must
+// not be used afterwards.
+func (x *Pair) Release(n int) {
+	p := x.p
+	p.mu.Lock()
+	p.pairN++
+	p.pairSrc += uint64(len(x.Src))
+	p.pairDst += uint64(n)
+	p.mu.Unlock()
+	p.Free(x.Dst)
+	p.Free(x.Src)
+	x.Src, x.Dst, x.p = nil, nil, nil
+}
+
+// PairStats reports the number of Pairs released and the combined lengths of
+// their Src buffers and of the bytes produced in Dst. The achieved ratio, for
+// example the compression ratio, is dstBytes/srcBytes.
+func (p *Pool) PairStats() (n, srcBytes, dstBytes uint64) {
+	p.mu.Lock()
+	n, srcBytes, dstBytes = p.pairN, p.pairSrc, p.pairDst
+	p.mu.Unlock()
+	return n, srcBytes, dstBytes
+}
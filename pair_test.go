@@ -0,0 +1,62 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestAllocPair(t *testing.T) {
+	p := NewPool(2, nil)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				x, err := p.AllocPair(ctx, 100, func(n int) int { return n + n/2 })
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if len(x.Src) != 100 || len(x.Dst) != 150 {
+					t.Error(len(x.Src), len(x.Dst))
+					return
+				}
+
+				x.Release(25)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, src, dst := p.PairStats(); n != 800 || src != 800*100 || dst != 800*25 {
+		t.Fatal(n, src, dst)
+	}
+}
+
+func TestAllocPairTooLarge(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewPool(1, nil).AllocPair(ctx, 10, nil); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	p := NewPool(2, &Options{Reserve: 1})
+	if _, err := p.AllocPair(WithPriority(ctx, Background), 10, nil); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	x, err := p.AllocPair(ctx, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x.Release(0)
+}
@@ -0,0 +1,31 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime"
+)
+
+// AllocPinned is like Alloc, but the backing array of the returned buffer is
+// pinned by a runtime.Pinner until the matching Free. The buffer can then be
+// passed to C code which retains it after the cgo call returns, as long as
+// it's not used by the C code after Free.
+func (p *Stack) AllocPinned(n int) []byte {
+	r := p.Alloc(n)
+	if cap(r) != 0 {
+		s := p.top()
+		s.pin = &runtime.Pinner{}
+		s.pin.Pin(&r[:1][0])
+	}
+	return r
+}
+
+// unpin unpins the buffer of s, if pinned.
+func (s *slot) unpin() {
+	if s.pin != nil {
+		s.pin.Unpin()
+		s.pin = nil
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"testing"
+)
+
+func TestAllocPinned(t *testing.T) {
+	b := NewStack(2)
+	buf := b.AllocPinned(100)
+	if g, e := len(buf), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	if b.top().pin == nil {
+		t.Fatal("buffer not pinned")
+	}
+
+	b.AllocPinned(0)
+	b.Free()
+	b.Free()
+	for _, v := range b.s {
+		if v.pin != nil {
+			t.Fatal("buffer not unpinned")
+		}
+	}
+}
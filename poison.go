@@ -0,0 +1,50 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+)
+
+// PoisonByte is the value the PoisonTail option fills the tails of allocated
+// buffers with.
+const PoisonByte = 0xa5
+
+// reserve records that the buffer of the allocated slot s is in use up to the
+// end of r, which must be a slice of s.b, and poisons the rest of s.b up to
+// its capacity. See the PoisonTail option.
+func (s *slot) reserve(r []byte) {
+	if cap(s.b) == 0 {
+		return
+	}
+
+	tail := len(r)
+	if cap(r) != 0 {
+		tail += int(addr(r) - addr(s.b))
+	}
+	if tail <= s.tail {
+		return
+	}
+
+	s.tail = tail
+	b := s.b[tail:cap(s.b)]
+	for i := range b {
+		b[i] = PoisonByte
+	}
+}
+
+// poisoned panics if the tail of the buffer of the allocated slot s, about to
+// be freed, is not poisoned anymore.
+func (p *Stack) poisoned(s *slot) {
+	if cap(s.b) == 0 {
+		return
+	}
+
+	for i, v := range s.b[s.tail:cap(s.b)] {
+		if v != PoisonByte {
+			p.fail(fmt.Errorf("Stack.Free: buffer written %d bytes past its length: %w", i, ErrOverrun))
+		}
+	}
+}
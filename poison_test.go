@@ -0,0 +1,36 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPoisonTail(t *testing.T) {
+	b := Make(WithSlots(2), WithPoisonTail())
+	r := b.Alloc(10)
+	copy(r, "0123456789")
+	b.Free()
+	r = b.Alloc(5)
+	if g := r[:cap(r)][5]; g != PoisonByte {
+		t.Fatalf("%#x", g)
+	}
+
+	r = b.Append(r, 'x')
+	b.Grow(r, 100)
+	r = append(r, make([]byte, 100)...)
+	b.Free()
+
+	r = b.AllocCap(1, 10)
+	r = append(r, "abcdefghi"...)
+	b.Free()
+
+	r = b.Alloc(5)
+	r[:6][5] = 0
+	if err := recovered(b.Free); !errors.Is(err, ErrOverrun) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,497 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// Pool is a bounded pool of buffers safe for concurrent use by multiple
+// goroutines. At most the configured number of buffers can be allocated at
+// the same time, AllocCtx waits for a buffer to be freed if necessary. The
+// free buffers are retained for later reuse the same way Cache does.
+type Pool struct {
+	mu        sync.Mutex
+	borrows   map[*byte]int      // Checked mode only.
+	sites     map[uintptr]string // Checked mode only: Free call sites of retained buffers.
+	sums      map[uintptr]uint32 // Checked mode only: checksums of retained buffers.
+	allocs    int                // Allocations counted for FailEveryN.
+	attached  uint64             // Buffers retained by Attach.
+	c         Cache
+	cachedB   int64 // Combined capacity of the buffers in c, see Stats.
+	cachedN   int   // Number of buffers in c.
+	checked   bool
+	clock     Clock
+	detached  uint64            // Buffers given away by Detach.
+	failN     int               // See the FailEveryN option.
+	fullSince time.Time         // Zero if not all buffers are allocated.
+	held      map[uintptr]Timer // MaxHold timers of the allocated buffers.
+	holds     map[uintptr]Timer // Watchdog timers of the allocated buffers.
+	hits      uint64            // Allocations served by a retained buffer.
+	hook      Hook
+	labels    *pprof.LabelSet
+	large     int                  // See the LargeThreshold option.
+	larges    map[uintptr]struct{} // Allocated buffers above large.
+	maxHold   time.Duration
+	misses    uint64          // Allocations served by a new buffer.
+	n         int             // Maximum number of allocated buffers.
+	name      string          // See the Name option.
+	notes     map[uintptr]any // See SetNote.
+	offB      uint64          // Combined capacity of the buffers written off by Loan.
+	offN      uint64          // Number of buffers written off by Loan.
+	pairDst   uint64          // Combined Dst bytes produced in released Pairs.
+	pairN     uint64          // Number of released Pairs.
+	pairSrc   uint64          // Combined Src lengths of released Pairs.
+	pairs     chan struct{}   // Serializes AllocPair.
+	rec       *recorder
+	reclaimed map[*byte]struct{} // Buffers reclaimed because of MaxHold, not yet freed.
+	reclB     uint64             // Combined capacity of the buffers reclaimed because of MaxHold.
+	reclN     uint64             // Number of buffers reclaimed because of MaxHold.
+	reserve   int                // Buffers available to Foreground allocations only.
+	saturated bool
+	threshold time.Duration
+	touch     bool               // See the TouchPages option.
+	transB    uint64             // Combined capacity of the buffers dropped by Free.
+	transN    uint64             // Number of buffers dropped by Free, see TransientStats.
+	used      int                // Number of allocated buffers.
+	vclock    float64            // Virtual time of the last hand over, see the Weights option.
+	vtimes    map[string]float64 // Per tag virtual time.
+	watchdog  time.Duration
+	waiters   []*waiter
+	weights   map[string]int
+}
+
+type waiter struct {
+	prio  Priority
+	tag   string        // See WithTag.
+	ready chan struct{} // Closed when a buffer is handed over.
+}
+
+// Priority is the priority of a Pool allocation, see WithPriority.
+type Priority int
+
+// Values of Priority.
+const (
+	// Foreground allocations may use all buffers of a Pool and are served
+	// first when waiting. This is the default.
+	Foreground Priority = iota
+
+	// Background allocations cannot use the buffers reserved by the
+	// Reserve option and are served only when no Foreground allocation
+	// waits.
+	Background
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx carrying prio. Pool.AllocCtx allocates
+// with this priority.
+func WithPriority(ctx context.Context, prio Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, prio)
+}
+
+func priorityOf(ctx context.Context) Priority {
+	prio, _ := ctx.Value(priorityKey{}).(Priority)
+	return prio
+}
+
+// NewPool returns a newly created Pool allowing at most n buffers to be
+// allocated at the same time. Hook, SaturationThreshold, Reserve, Checked,
+// Name, ProfileLabels, Record, Watchdog, MaxHold, Weights, LargeThreshold,
+// FailEveryN, TouchPages and Clock of o apply, o may be nil.
+func NewPool(n int, o *Options) *Pool {
+	p := &Pool{n: n, clock: systemClock{}, pairs: make(chan struct{}, 1)}
+	if o != nil {
+		p.hook = o.Hook
+		p.name = o.Name
+		p.labels = newLabels(o)
+		p.reserve = min(max(o.Reserve, 0), n)
+		p.threshold = o.SaturationThreshold
+		p.failN = o.FailEveryN
+		p.touch = o.TouchPages
+		if p.checked = o.Checked; p.checked {
+			p.borrows = map[*byte]int{}
+			p.sites = map[uintptr]string{}
+			p.sums = map[uintptr]uint32{}
+		}
+		if o.Clock != nil {
+			p.clock = o.Clock
+		}
+		if o.Record != nil {
+			p.rec = newRecorder(o.Record)
+		}
+		if o.LargeThreshold > 0 {
+			p.large = o.LargeThreshold
+			p.larges = map[uintptr]struct{}{}
+		}
+		if o.Weights != nil {
+			p.weights = o.Weights
+			p.vtimes = map[string]float64{}
+		}
+		if o.MaxHold > 0 {
+			p.maxHold = o.MaxHold
+			p.held = map[uintptr]Timer{}
+			p.reclaimed = map[*byte]struct{}{}
+		}
+		if o.Watchdog > 0 {
+			p.watchdog = o.Watchdog
+			p.holds = map[uintptr]Timer{}
+		}
+	}
+	return p
+}
+
+// AllocCtx returns a buffer of length n. If all buffers are allocated,
+// AllocCtx waits until one is freed or ctx is done, in which case it returns
+// ctx.Err(). The priority of the allocation is taken from ctx, see
+// WithPriority.
+//
+// NOTE: The buffer returned by AllocCtx _is not guaranteed_ to be zeroed.
+func (p *Pool) AllocCtx(ctx context.Context, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Pool.AllocCtx: size %d: %w", n, ErrInvalidSize)
+	}
+
+	prio := priorityOf(ctx)
+	p.mu.Lock()
+	if p.failN > 0 {
+		if p.allocs++; p.allocs%p.failN == 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("Pool.AllocCtx: injected failure: %w", ErrExhausted)
+		}
+	}
+
+	if r, ok := p.grab(prio, n); ok {
+		p.mu.Unlock()
+		return r, nil
+	}
+
+	w := &waiter{prio: prio, tag: tagOf(ctx), ready: make(chan struct{})}
+	if p.weights != nil {
+		p.activate(w.tag)
+	}
+	p.waiters = append(p.waiters, w)
+	e, d := p.checkSaturated()
+	p.mu.Unlock()
+	p.emit(e)
+
+	var timer <-chan time.Time
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timer = t.C
+	}
+	for {
+		select {
+		case <-w.ready:
+			p.mu.Lock()
+			r := p.get(n)
+			p.mu.Unlock()
+			return r, nil
+		case <-ctx.Done():
+			p.mu.Lock()
+			if p.dequeue(w) {
+				p.mu.Unlock()
+				return nil, ctx.Err()
+			}
+
+			// Lost the race with Free, the buffer was already handed
+			// over.
+			p.mu.Unlock()
+			p.free(nil)
+			return nil, ctx.Err()
+		case <-timer:
+			timer = nil
+			p.mu.Lock()
+			e, _ := p.checkSaturated()
+			p.mu.Unlock()
+			p.emit(e)
+		}
+	}
+}
+
+// AllocTimeout is like AllocCtx, with Foreground priority, but waits at most
+// d for a buffer to be freed. If none is, AllocTimeout returns an error
+// satisfying errors.Is(err, ErrTimeout). Failures injected by the FailEveryN
+// option satisfy errors.Is(err, ErrExhausted).
+func (p *Pool) AllocTimeout(n int, d time.Duration) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Pool.AllocTimeout: size %d: %w", n, ErrInvalidSize)
+	}
+
+	if p.failN == 0 { // Otherwise AllocCtx counts the allocation.
+		p.mu.Lock()
+		r, ok := p.grab(Foreground, n)
+		p.mu.Unlock()
+		if ok {
+			return r, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	r, err := p.AllocCtx(ctx, n)
+	if errors.Is(err, ErrExhausted) {
+		return nil, fmt.Errorf("Pool.AllocTimeout: %w", err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Pool.AllocTimeout: %w", ErrTimeout)
+	}
+
+	return r, nil
+}
+
+// grab returns a buffer of length n if an allocation with priority prio can
+// proceed without waiting. It must be called with p.mu held.
+func (p *Pool) grab(prio Priority, n int) ([]byte, bool) {
+	if p.used >= p.limit(prio) || prio != Foreground && len(p.waiters) != 0 {
+		return nil, false
+	}
+
+	p.used++
+	if p.used == p.n {
+		p.fullSince = p.clock.Now()
+	}
+	return p.get(n), true
+}
+
+// get returns p.c.Get(n). It must be called with p.mu held.
+func (p *Pool) get(n int) (r []byte) {
+	if p.checked {
+		defer func() {
+			p.verify(r)
+			delete(p.sites, addr(r))
+		}()
+	}
+	if p.rec != nil {
+		defer func() { p.rec.alloc(r, n) }()
+	}
+	if p.watchdog > 0 {
+		defer func() { p.watch(r) }()
+	}
+	if p.maxHold > 0 {
+		defer func() { p.hold(r) }()
+	}
+
+	if p.large > 0 && n > p.large {
+		p.misses++
+		r := p.makeBuf(n, n)
+		p.larges[addr(r)] = struct{}{}
+		return r
+	}
+
+	if (p.labels != nil || p.touch) && (len(p.c) == 0 || len(p.c[len(p.c)-1]) < n) {
+		// Cache.Get would allocate.
+		p.misses++
+		r := p.makeBuf(n, overCommit(n))
+		if len(p.c) != 0 {
+			p.uncache(cap(p.c[len(p.c)-1]))
+			p.c = p.c[:len(p.c)-1] // Get would replace the biggest one.
+		}
+		return r
+	}
+
+	r, isNew, removed := p.c.get(n)
+	p.uncache(removed)
+	switch {
+	case isNew:
+		p.misses++
+	default:
+		p.hits++
+	}
+	return r
+}
+
+// cache puts b to p.c. It must be called with p.mu held.
+func (p *Pool) cache(b []byte) {
+	p.c.Put(b)
+	if cap(b) != 0 {
+		p.cachedN++
+		p.cachedB += int64(cap(b))
+	}
+}
+
+// uncache accounts for a buffer of capacity removed, if positive, removed
+// from p.c. It must be called with p.mu held.
+func (p *Pool) uncache(removed int) {
+	if removed > 0 {
+		p.cachedN--
+		p.cachedB -= int64(removed)
+	}
+}
+
+// Free returns b, obtained from AllocCtx, to the pool. No other references
+// to b's backing array may exist.
+func (p *Pool) Free(b []byte) { p.free(b) }
+
+func (p *Pool) free(b []byte) {
+	p.mu.Lock()
+	if b != nil && p.maxHold > 0 && p.unhold(b) {
+		p.mu.Unlock()
+		return
+	}
+
+	if b != nil {
+		if p.checked {
+			p.check(b)
+		}
+		p.forget(b)
+		if p.rec != nil {
+			p.rec.free(b)
+		}
+		if p.watchdog > 0 {
+			p.unwatch(b)
+		}
+		if !p.dropLarge(b) {
+			p.cache(b)
+			if p.checked && cap(b) != 0 {
+				p.sums[addr(b)] = checksum(b)
+			}
+		}
+	}
+	if w := p.next(); w != nil {
+		p.dequeue(w)
+		if p.weights != nil {
+			p.charge(w.tag)
+		}
+		close(w.ready)
+		p.mu.Unlock()
+		return
+	}
+
+	p.used--
+	p.fullSince = time.Time{}
+	var e Event
+	if p.saturated {
+		p.saturated = false
+		e = Event{Kind: EventRelieved, Time: p.clock.Now()}
+	}
+	p.mu.Unlock()
+	p.emit(e)
+}
+
+// dropLarge reports whether b is an allocation above the LargeThreshold
+// option, which is not retained. It must be called with p.mu held.
+func (p *Pool) dropLarge(b []byte) bool {
+	if p.large == 0 || cap(b) <= p.large {
+		return false
+	}
+
+	if _, ok := p.larges[addr(b)]; !ok {
+		return false
+	}
+
+	delete(p.larges, addr(b))
+	delete(p.sites, addr(b))
+	p.transN++
+	p.transB += uint64(cap(b))
+	return true
+}
+
+// TransientStats reports the number and combined capacity of the buffers
+// which were not retained by Free because of the LargeThreshold option. They
+// are not included in Stats.
+func (p *Pool) TransientStats() (n, bytes uint64) {
+	p.mu.Lock()
+	n, bytes = p.transN, p.transB
+	p.mu.Unlock()
+	return n, bytes
+}
+
+// limit returns the number of buffers allocations with priority prio can use.
+func (p *Pool) limit(prio Priority) int {
+	if prio == Foreground {
+		return p.n
+	}
+
+	return p.n - p.reserve
+}
+
+// next returns the waiter to hand over a buffer being freed to, if any. It
+// must be called with p.mu held.
+func (p *Pool) next() *waiter {
+	if w := p.first(true); w != nil {
+		return w
+	}
+
+	if bg := p.first(false); bg != nil && p.used-1 < p.limit(bg.prio) {
+		return bg
+	}
+
+	return nil
+}
+
+// first returns the waiter to be served first among the Foreground waiters,
+// if fg, or among the others. It must be called with p.mu held.
+func (p *Pool) first(fg bool) (r *waiter) {
+	for _, w := range p.waiters {
+		if (w.prio == Foreground) != fg {
+			continue
+		}
+
+		if p.weights == nil {
+			return w
+		}
+
+		if r == nil || p.vtimes[w.tag] < p.vtimes[r.tag] {
+			r = w
+		}
+	}
+	return r
+}
+
+// dequeue removes w from the waiters and reports whether it was found.
+func (p *Pool) dequeue(w *waiter) bool {
+	for i, v := range p.waiters {
+		if v == w {
+			copy(p.waiters[i:], p.waiters[i+1:])
+			p.waiters[len(p.waiters)-1] = nil
+			p.waiters = p.waiters[:len(p.waiters)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// checkSaturated returns EventSaturated if the pool just became saturated.
+// Otherwise, if the pool may become saturated later, it returns the time
+// remaining till then. It must be called with p.mu held.
+func (p *Pool) checkSaturated() (e Event, remaining time.Duration) {
+	if p.hook == nil || p.saturated || p.fullSince.IsZero() {
+		return e, 0
+	}
+
+	now := p.clock.Now()
+	if remaining = p.threshold - now.Sub(p.fullSince); remaining > 0 {
+		return e, remaining
+	}
+
+	p.saturated = true
+	return Event{Kind: EventSaturated, Time: now}, 0
+}
+
+func (p *Pool) emit(e Event) {
+	if e.Kind != 0 && p.hook != nil {
+		p.hook.Event(e)
+	}
+}
+
+// Stats reports memory consumed by a Pool, without accounting for some
+// (smallish) additional overhead. 'n' is the number of free buffers retained,
+// bytes is their combined capacity. The statistics are maintained
+// incrementally, Stats takes constant time.
+func (p *Pool) Stats() (n int, bytes int64) {
+	p.mu.Lock()
+	n, bytes = p.cachedN, p.cachedB
+	p.mu.Unlock()
+	return
+}
@@ -0,0 +1,226 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2, nil)
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 10)
+	b, _ := p.AllocCtx(ctx, 20)
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if _, err := p.AllocCtx(tctx, 1); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	done := make(chan []byte)
+	go func() {
+		r, _ := p.AllocCtx(ctx, 30)
+		done <- r
+	}()
+	p.Free(a)
+	if g, e := len(<-done), 30; g != e {
+		t.Fatal(g, e)
+	}
+
+	p.Free(b)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r, _ := p.AllocCtx(ctx, j)
+				p.Free(r)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := p.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestPoolSaturation(t *testing.T) {
+	clock := &testClock{t: time.Unix(1e9, 0)}
+	var mu sync.Mutex
+	var events []EventKind
+	hook := HookFunc(func(e Event) {
+		mu.Lock()
+		events = append(events, e.Kind)
+		mu.Unlock()
+	})
+	p := NewPool(1, &Options{Hook: hook, SaturationThreshold: time.Second, Clock: clock})
+	ctx := context.Background()
+	b, _ := p.AllocCtx(ctx, 1)
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	p.AllocCtx(tctx, 1) // Not saturated long enough.
+	clock.advance(time.Second)
+	done := make(chan struct{})
+	go func() {
+		r, _ := p.AllocCtx(ctx, 1)
+		p.Free(r)
+		close(done)
+	}()
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n != 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+	p.Free(b)
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != EventSaturated || events[1] != EventRelieved {
+		t.Fatal(events)
+	}
+}
+
+func TestPoolPriority(t *testing.T) {
+	p := NewPool(2, &Options{Reserve: 1})
+	fg := context.Background()
+	bg := WithPriority(fg, Background)
+	a, _ := p.AllocCtx(bg, 1)
+	tctx, cancel := context.WithTimeout(bg, time.Millisecond)
+	defer cancel()
+	if _, err := p.AllocCtx(tctx, 1); err == nil {
+		t.Fatal("background allocation used the reserve")
+	}
+
+	b, err := p.AllocCtx(fg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan Priority, 2)
+	go func() {
+		r, _ := p.AllocCtx(bg, 1)
+		order <- Background
+		p.Free(r)
+	}()
+	for {
+		p.mu.Lock()
+		n := len(p.waiters)
+		p.mu.Unlock()
+		if n == 1 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		r, _ := p.AllocCtx(fg, 1)
+		order <- Foreground
+		p.Free(r)
+	}()
+	for {
+		p.mu.Lock()
+		n := len(p.waiters)
+		p.mu.Unlock()
+		if n == 2 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+	p.Free(a)
+	if g, e := <-order, Foreground; g != e {
+		t.Fatal(g, e)
+	}
+
+	p.Free(b)
+	if g, e := <-order, Background; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func TestPoolAllocTimeout(t *testing.T) {
+	p := NewPool(1, nil)
+	b, err := p.AllocTimeout(10, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.AllocTimeout(10, time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(time.Millisecond, func() { p.Free(b) })
+	if _, err := p.AllocTimeout(10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolWatchdog(t *testing.T) {
+	events := make(chan Event, 1)
+	p := NewPool(2, &Options{
+		Watchdog: 10 * time.Millisecond,
+		Hook:     HookFunc(func(e Event) { events <- e }),
+	})
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 10)
+	p.Free(a)
+	p.AllocCtx(ctx, 20)
+	select {
+	case e := <-events:
+		if e.Kind != EventHeldTooLong || !strings.Contains(string(e.Stack), "TestPoolWatchdog") {
+			t.Fatalf("%+v", e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event")
+	}
+
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPoolLargeThreshold(t *testing.T) {
+	p := NewPool(2, &Options{LargeThreshold: 100})
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 50)
+	b, _ := p.AllocCtx(ctx, 1000)
+	p.Free(a)
+	p.Free(b)
+	if n, bytes := p.Stats(); n != 1 || bytes != int64(cap(a)) {
+		t.Fatal(n, bytes)
+	}
+
+	if n, bytes := p.TransientStats(); n != 1 || bytes != 1000 {
+		t.Fatal(n, bytes)
+	}
+}
+
+func TestPoolStatsIncremental(t *testing.T) {
+	p := NewPool(3, &Options{LargeThreshold: 100})
+	ctx := context.Background()
+	for _, n := range []int{10, 50, 1000, 5, 70} {
+		a, _ := p.AllocCtx(ctx, n)
+		b, _ := p.AllocCtx(ctx, 2*n)
+		p.Free(a)
+		p.Free(b)
+		cn, cb := p.c.Stats64()
+		if n, bytes := p.Stats(); n != cn || bytes != cb {
+			t.Fatal(n, bytes, cn, cb)
+		}
+	}
+}
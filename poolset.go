@@ -0,0 +1,59 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"sync"
+)
+
+// PoolSet is a set of isolated Pools keyed by name. It's safe for concurrent
+// use by multiple goroutines.
+type PoolSet struct {
+	mu    sync.Mutex
+	n     int
+	pools map[string]*Pool
+}
+
+// NewPoolSet returns a newly created PoolSet whose Pools allow at most n
+// buffers to be allocated at the same time.
+func NewPoolSet(n int) *PoolSet {
+	return &PoolSet{n: n, pools: map[string]*Pool{}}
+}
+
+// GetPool returns the Pool named name, creating it by NewPool if it does not
+// exist yet. o is used only when the Pool is created, it may be nil. The Name
+// option of the created Pool defaults to name.
+func (s *PoolSet) GetPool(name string, o *Options) *Pool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p := s.pools[name]; p != nil {
+		return p
+	}
+
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.Name == "" {
+		opts.Name = name
+	}
+	p := NewPool(s.n, &opts)
+	s.pools[name] = p
+	return p
+}
+
+// Stats reports the sums of Pool.Stats of all Pools in s.
+func (s *PoolSet) Stats() (n int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.pools {
+		pn, pbytes := p.Stats()
+		n += pn
+		bytes += pbytes
+	}
+	return n, bytes
+}
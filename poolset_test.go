@@ -0,0 +1,32 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPoolSet(t *testing.T) {
+	s := NewPoolSet(1)
+	a := s.GetPool("a", nil)
+	if s.GetPool("a", &Options{Reserve: 1}) != a {
+		t.Fatal("GetPool created a duplicate pool")
+	}
+
+	b := s.GetPool("b", nil)
+	if a == b {
+		t.Fatal("pools not isolated")
+	}
+
+	ctx := context.Background()
+	x, _ := a.AllocCtx(ctx, 10)
+	y, _ := b.AllocCtx(ctx, 100) // Would block if shared with a.
+	a.Free(x)
+	b.Free(y)
+	if n, bytes := s.Stats(); n != 2 || bytes != int64(cap(x)+cap(y)) {
+		t.Fatal(n, bytes)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build race
+
+package bufs
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// The race detector annotations of the lock-free caches. The internal
+// synchronization of a cache is hidden from the detector, which instead sees
+// the ownership of every buffer transferred from Put to the Get returning it.
+// Accesses to a buffer made after Put by the goroutine which put it are then
+// reported as races with the goroutine which got it, even if both goroutines
+// used the cache in between.
+//
+// The mutex based caches cannot hide their synchronization, the detector must
+// see the accesses to their internal state ordered.
+
+const raceEnabled = true
+
+func raceAcquire(p unsafe.Pointer)      { runtime.RaceAcquire(p) }
+func raceReleaseMerge(p unsafe.Pointer) { runtime.RaceReleaseMerge(p) }
+func raceDisable()                      { runtime.RaceDisable() }
+func raceEnable()                       { runtime.RaceEnable() }
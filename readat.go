@@ -0,0 +1,43 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadAt reads n bytes at offset off of r into a buffer allocated from p and
+// returns the buffer. The read itself covers the region extended to
+// multiples of align at both ends and goes to a buffer aligned to align,
+// which must be a power of 2, as required for example by direct I/O. The
+// returned buffer is the requested part of it. Use align 1 if no alignment is
+// needed. It's a building block for reading database pages into pooled
+// memory, without double buffering.
+//
+// The buffer must be freed by Free, as if it was returned by Alloc. If ReadAt
+// fails, nothing remains allocated. Reaching the end of r in the extended
+// part of the region is not an error.
+func (p *Stack) ReadAt(r io.ReaderAt, off int64, n, align int) ([]byte, error) {
+	if off < 0 {
+		return nil, errors.New("Stack.ReadAt: negative offset")
+	}
+
+	a := int64(align)
+	start := off &^ (a - 1)
+	end := (off + int64(n) + a - 1) &^ (a - 1)
+	buf := p.AllocAligned(int(end-start), align)
+	pad := int(off - start)
+	k, err := r.ReadAt(buf, start)
+	switch {
+	case k >= pad+n:
+		return buf[pad : pad+n], nil
+	case err == nil || err == io.EOF:
+		err = io.ErrUnexpectedEOF
+	}
+	p.Free()
+	return nil, fmt.Errorf("Stack.ReadAt: %w", err)
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestReadAt(t *testing.T) {
+	r := strings.NewReader("0123456789abcdefghij")
+	b := NewStack(1)
+	buf, err := b.ReadAt(r, 5, 10, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(buf), "56789abcde"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if uintptr(unsafe.Pointer(&buf[0]))%8 != 5 {
+		t.Fatal("misaligned")
+	}
+
+	b.Free()
+	if buf, err = b.ReadAt(r, 15, 5, 8); err != nil || string(buf) != "fghij" {
+		t.Fatal(err, string(buf))
+	}
+
+	b.Free()
+	if _, err = b.ReadAt(r, 15, 10, 8); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal(err)
+	}
+
+	if g, e := b.Depth(), 0; g != e {
+		t.Fatal(g, e)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The log written by a Pool having the Record option set is a sequence of
+// records, each being an op byte followed by an uvarint argument. The argument
+// of recAlloc is the requested size, the argument of recFree is the sequence
+// number, counted from zero, of the recAlloc record of the buffer being freed.
+const (
+	recAlloc = 'a'
+	recFree  = 'f'
+)
+
+// replayMaxSize is the biggest allocation Replay attempts. Bigger sizes in a
+// log are taken for corruption rather than allocated.
+const replayMaxSize = 1 << 32
+
+type recorder struct {
+	w    io.Writer
+	buf  []byte
+	err  error              // First write error, stops recording.
+	ids  map[uintptr]uint64 // Buffer address: sequence number.
+	zero []uint64           // Sequence numbers of zero capacity buffers.
+	seq  uint64
+}
+
+func newRecorder(w io.Writer) *recorder {
+	return &recorder{w: w, ids: map[uintptr]uint64{}}
+}
+
+func (r *recorder) alloc(b []byte, n int) {
+	switch {
+	case cap(b) == 0:
+		r.zero = append(r.zero, r.seq)
+	default:
+		r.ids[addr(b)] = r.seq
+	}
+	r.seq++
+	r.write(recAlloc, uint64(n))
+}
+
+func (r *recorder) free(b []byte) {
+	var id uint64
+	switch {
+	case cap(b) == 0:
+		if len(r.zero) == 0 {
+			return
+		}
+
+		id = r.zero[len(r.zero)-1]
+		r.zero = r.zero[:len(r.zero)-1]
+	default:
+		var ok bool
+		if id, ok = r.ids[addr(b)]; !ok {
+			return
+		}
+
+		delete(r.ids, addr(b))
+	}
+	r.write(recFree, id)
+}
+
+func (r *recorder) write(op byte, arg uint64) {
+	if r.err != nil {
+		return
+	}
+
+	r.buf = binary.AppendUvarint(append(r.buf[:0], op), arg)
+	_, r.err = r.w.Write(r.buf)
+}
+
+// Replay replays the allocations and frees of a log written by a Pool having
+// the Record option set against p. Buffers still allocated at the end of the
+// log are freed before returning. Replay fails with ErrExhausted if the log
+// needs more buffers allocated at the same time than p allows and with
+// ErrTooLarge if the log requests a buffer bigger than 4 GiB.
+//
+// Replay is meant for experimenting with pool configurations offline using a
+// workload captured in production, comparing for example the Stats of the
+// pools afterwards.
+func Replay(log io.Reader, p *Pool) error {
+	var live [][]byte
+	var ok []bool // Whether live[i] is allocated.
+	defer func() {
+		for i, b := range live {
+			if ok[i] {
+				p.Free(b)
+			}
+		}
+	}()
+
+	r := bufio.NewReader(log)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		arg, err := binary.ReadUvarint(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("Replay: %w", err)
+		}
+
+		switch op {
+		case recAlloc:
+			if arg > math.MaxInt || arg > replayMaxSize {
+				return fmt.Errorf("Replay: allocation of %d bytes: %w", arg, ErrTooLarge)
+			}
+
+			b, grabbed := func() ([]byte, bool) {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+
+				return p.grab(Foreground, int(arg))
+			}()
+			if !grabbed {
+				return fmt.Errorf("Replay: %d buffers in use: %w", p.n, ErrExhausted)
+			}
+
+			live = append(live, b)
+			ok = append(ok, true)
+		case recFree:
+			if arg >= uint64(len(live)) || !ok[arg] {
+				return fmt.Errorf("Replay: invalid free of buffer %d", arg)
+			}
+
+			p.Free(live[arg])
+			live[arg], ok[arg] = nil, false
+		default:
+			return fmt.Errorf("Replay: invalid record op %#x", op)
+		}
+	}
+}
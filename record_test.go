@@ -0,0 +1,56 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	var log bytes.Buffer
+	p := NewPool(3, &Options{Record: &log})
+	ctx := context.Background()
+	a, _ := p.AllocCtx(ctx, 10)
+	b, _ := p.AllocCtx(ctx, 100)
+	c, _ := p.AllocCtx(ctx, 0)
+	p.Free(a)
+	p.Free(c)
+	a, _ = p.AllocCtx(ctx, 1000)
+	p.Free(b)
+	p.Free(a)
+	wn, wb := p.Stats()
+
+	q := NewPool(3, nil)
+	if err := Replay(bytes.NewReader(log.Bytes()), q); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, b := q.Stats(); n != wn || b != wb {
+		t.Fatal(n, b, wn, wb)
+	}
+
+	if err := Replay(bytes.NewReader(log.Bytes()), NewPool(2, nil)); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+
+	if err := Replay(bytes.NewReader([]byte{recFree, 0}), NewPool(1, nil)); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	for _, n := range []uint64{1 << 63, replayMaxSize + 1} {
+		q := NewPool(1, nil)
+		if err := Replay(bytes.NewReader(binary.AppendUvarint([]byte{recAlloc}, n)), q); !errors.Is(err, ErrTooLarge) {
+			t.Fatal(n, err)
+		}
+
+		if _, err := q.AllocCtx(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// NopCloserWithRelease returns an io.ReadCloser reading b. Its Close returns
+// b to a, so pooled buffers can be passed to APIs taking an io.ReadCloser,
+// like HTTP response bodies, without tracking their lifetime. b must have
+// been obtained from a and must not be used by the caller afterwards.
+//
+// The returned value implements io.WriterTo as well. It's not safe for
+// concurrent use by multiple goroutines.
+func NopCloserWithRelease(b []byte, a Allocator) io.ReadCloser {
+	r := &releaseReader{a: a, b: b}
+	r.r.Reset(b)
+	return r
+}
+
+type releaseReader struct {
+	a Allocator
+	b []byte
+	r bytes.Reader
+
+	closed bool
+}
+
+// Read implements io.Reader.
+func (r *releaseReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, fmt.Errorf("Read: %w", ErrClosed)
+	}
+
+	return r.r.Read(p)
+}
+
+// WriteTo implements io.WriterTo.
+func (r *releaseReader) WriteTo(w io.Writer) (int64, error) {
+	if r.closed {
+		return 0, fmt.Errorf("WriteTo: %w", ErrClosed)
+	}
+
+	return r.r.WriteTo(w)
+}
+
+// Close implements io.Closer.
+func (r *releaseReader) Close() error {
+	if r.closed {
+		return fmt.Errorf("Close: %w", ErrClosed)
+	}
+
+	r.r.Reset(nil)
+	r.a.Put(r.b)
+	r.b, r.closed = nil, true
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNopCloserWithRelease(t *testing.T) {
+	var c CCache
+	b := c.Get(5)
+	copy(b, "hello")
+	rc := NopCloserWithRelease(b, &c)
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(data), "hello"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := c.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if err := rc.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatal(err)
+	}
+
+	if _, err := rc.Read(make([]byte, 1)); !errors.Is(err, ErrClosed) {
+		t.Fatal(err)
+	}
+}
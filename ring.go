@@ -0,0 +1,210 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"io"
+)
+
+// Ring is a circular byte buffer with storage obtained from a CCache. It's
+// intended for streaming parsers and network framing layers which need to
+// look ahead (Peek) before consuming (Discard) the data. The storage grows on
+// demand, the old storage is returned to the cache. Ring implements
+// io.WriterTo and io.ReaderFrom, so io.Copy reads and writes its storage
+// directly.
+//
+// A Ring is not safe for concurrent use by multiple goroutines.
+type Ring struct {
+	c   *CCache
+	buf []byte
+	r   int // Read position.
+	n   int // Number of buffered bytes.
+
+	closed bool
+}
+
+// NewRing returns a newly created Ring with initial capacity of at least
+// size bytes obtained from c. If c is nil, GCache is used.
+func NewRing(c *CCache, size int) *Ring {
+	if c == nil {
+		c = &GCache
+	}
+	r := &Ring{c: c}
+	if size > 0 {
+		r.buf = c.Get(size)
+		r.buf = r.buf[:cap(r.buf)]
+	}
+	return r
+}
+
+// Len returns the number of buffered bytes.
+func (r *Ring) Len() int { return r.n }
+
+// Cap returns the capacity of the current storage.
+func (r *Ring) Cap() int { return len(r.buf) }
+
+// Write appends p to the buffered data, growing the storage if necessary. It
+// never returns an error.
+func (r *Ring) Write(p []byte) (int, error) {
+	if r.n+len(p) > len(r.buf) {
+		r.grow(r.n + len(p))
+	}
+
+	w := (r.r + r.n) % max(len(r.buf), 1)
+	k := copy(r.buf[w:], p)
+	copy(r.buf, p[k:])
+	r.n += len(p)
+	return len(p), nil
+}
+
+// Peek returns the next n buffered bytes without consuming them. The result
+// is valid until the next call of a Ring method other than Len or Cap. If the
+// bytes wrap around the end of the storage, Peek compacts the Ring first.
+// Peek fails if less than n bytes are buffered.
+func (r *Ring) Peek(n int) ([]byte, error) {
+	if n < 0 || n > r.n {
+		return nil, io.ErrShortBuffer
+	}
+
+	if r.r+n > len(r.buf) {
+		r.Compact()
+	}
+	return r.buf[r.r : r.r+n], nil
+}
+
+// Discard consumes the next n buffered bytes, or all of them if less than n
+// are buffered, and returns the number of bytes discarded.
+func (r *Ring) Discard(n int) int {
+	if n > r.n {
+		n = r.n
+	}
+	if n <= 0 {
+		return 0
+	}
+
+	r.r = (r.r + n) % len(r.buf)
+	r.n -= n
+	if r.n == 0 {
+		r.r = 0
+	}
+	return n
+}
+
+// Read reads and consumes up to len(p) buffered bytes. It returns io.EOF if
+// the Ring is empty.
+func (r *Ring) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.buf[r.r:min(r.r+r.n, len(r.buf))])
+	if n < len(p) && n < r.n {
+		n += copy(p[n:], r.buf[:r.n-n])
+	}
+	return r.Discard(n), nil
+}
+
+// WriteTo implements io.WriterTo. It writes and consumes the buffered bytes
+// until the Ring is empty or an error occurs.
+func (r *Ring) WriteTo(w io.Writer) (n int64, err error) {
+	for r.n != 0 {
+		b := r.buf[r.r:min(r.r+r.n, len(r.buf))]
+		k, err := w.Write(b)
+		n += int64(r.Discard(k))
+		if err != nil {
+			return n, err
+		}
+
+		if k != len(b) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// ringMinRead is the minimum free space ReadFrom offers to a Read call.
+const ringMinRead = 512
+
+// ReadFrom implements io.ReaderFrom. It appends the data read from rd until
+// io.EOF or an error occurs, growing the storage if necessary. io.EOF is not
+// reported as an error.
+func (r *Ring) ReadFrom(rd io.Reader) (n int64, err error) {
+	for {
+		if len(r.buf)-r.n < ringMinRead {
+			r.grow(r.n + ringMinRead)
+		}
+
+		w := (r.r + r.n) % len(r.buf)
+		end := len(r.buf)
+		if w < r.r {
+			end = r.r
+		}
+		k, err := rd.Read(r.buf[w:end])
+		if k < 0 || k > end-w {
+			panic(fmt.Errorf("Ring.ReadFrom: invalid Read count %d", k))
+		}
+
+		r.n += k
+		n += int64(k)
+		if err == io.EOF {
+			return n, nil
+		}
+
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Compact moves the buffered bytes to the start of the storage, making them
+// contiguous.
+func (r *Ring) Compact() {
+	if r.r == 0 {
+		return
+	}
+
+	if r.r+r.n <= len(r.buf) {
+		copy(r.buf, r.buf[r.r:r.r+r.n])
+		r.r = 0
+		return
+	}
+
+	r.relocate(r.c.Get(len(r.buf)))
+}
+
+// Close returns the storage to the cache. The Ring must not be used
+// afterwards.
+func (r *Ring) Close() error {
+	if r.closed {
+		return fmt.Errorf("Ring.Close: %w", ErrClosed)
+	}
+
+	if r.buf != nil {
+		r.c.Put(r.buf)
+	}
+	r.buf, r.r, r.n, r.closed = nil, 0, 0, true
+	return nil
+}
+
+func (r *Ring) grow(n int) {
+	r.relocate(r.c.Get(max(n, 2*len(r.buf))))
+}
+
+// relocate copies the buffered bytes to the start of b, which becomes the new
+// storage, and returns the old storage to the cache.
+func (r *Ring) relocate(b []byte) {
+	b = b[:cap(b)]
+	k := copy(b, r.buf[r.r:min(r.r+r.n, len(r.buf))])
+	copy(b[k:], r.buf[:r.n-k])
+	if r.buf != nil {
+		r.c.Put(r.buf)
+	}
+	r.buf, r.r = b, 0
+}
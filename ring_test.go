@@ -0,0 +1,80 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	var c CCache
+	r := NewRing(&c, 4) // cap 8
+	r.Write([]byte("abcdef"))
+	if g, e := r.Discard(4), 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	r.Write([]byte("ghij")) // Wraps around.
+	if g, e := r.Cap(), 8; g != e {
+		t.Fatal(g, e)
+	}
+
+	b, err := r.Peek(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(b), "efghij"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if _, err := r.Peek(7); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	r.Write(bytes.Repeat([]byte("k"), 10)) // Grows.
+	all, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(all), "efghijkkkkkkkkkk"; g != e {
+		t.Fatal(g, e)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := c.Stats(); n == 0 {
+		t.Fatal(n)
+	}
+}
+
+func TestRingCopy(t *testing.T) {
+	var c CCache
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	r := NewRing(&c, 4)
+	r.Write([]byte("abc"))
+	r.Discard(2) // Make the data wrap around eventually.
+	if n, err := io.Copy(r, bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatal(n, err)
+	}
+
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, r); err != nil || n != int64(len(data))+1 {
+		t.Fatal(n, err)
+	}
+
+	if g, e := buf.String(), "c"+string(data); g != e {
+		t.Fatal(len(g), len(e))
+	}
+
+	if r.Len() != 0 {
+		t.Fatal(r.Len())
+	}
+}
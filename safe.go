@@ -0,0 +1,36 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+// SafeAlloc is like Alloc, but instead of panicking it returns the error the
+// panic would carry, for example one satisfying errors.Is(err,
+// ErrExhausted). Panics not carrying an error are not recovered.
+func (p *Stack) SafeAlloc(n int) (r []byte, err error) {
+	defer recoverError(&err)
+
+	return p.Alloc(n), nil
+}
+
+// SafeFree is like Free, but instead of panicking it returns the error the
+// panic would carry, for example one satisfying errors.Is(err,
+// ErrDoubleFree). Panics not carrying an error are not recovered.
+func (p *Stack) SafeFree() (err error) {
+	defer recoverError(&err)
+
+	p.Free()
+	return nil
+}
+
+// recoverError recovers a panic carrying an error and stores the error in
+// *err. It must be deferred directly.
+func recoverError(err *error) {
+	switch x := recover().(type) {
+	case nil:
+	case error:
+		*err = x
+	default:
+		panic(x)
+	}
+}
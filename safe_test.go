@@ -0,0 +1,33 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSafe(t *testing.T) {
+	b := NewStack(1)
+	if _, err := b.SafeAlloc(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.SafeAlloc(10); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+
+	if _, err := b.SafeAlloc(-1); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+
+	if err := b.SafeFree(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SafeFree(); !errors.Is(err, ErrDoubleFree) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Sample records memory retained by a pool together with the memory
+// statistics of the Go runtime at the same moment.
+type Sample struct {
+	Time      time.Time
+	Retained  int64  // Bytes retained by the pool(s).
+	HeapAlloc uint64 // runtime.MemStats.HeapAlloc
+	HeapInuse uint64 // runtime.MemStats.HeapInuse
+	HeapSys   uint64 // runtime.MemStats.HeapSys
+	Sys       uint64 // runtime.MemStats.Sys, a rough estimate of the RSS.
+}
+
+// Sampler collects a timeline of Samples. It helps to demonstrate that the
+// memory retained by pools, not a leak, accounts for a process' RSS plateau.
+//
+// Taking a sample calls runtime.ReadMemStats, which stops the world briefly.
+// Do not sample too often.
+type Sampler struct {
+	clock    Clock
+	interval time.Duration
+	mu       sync.Mutex
+	n        int // Number of samples taken.
+	retained func() int64
+	running  sync.WaitGroup // Periodic samples in progress.
+	samples  []Sample       // Ring buffer of the last cap(samples) samples.
+	stopped  bool
+	timer    Timer // Next periodic sample, nil if none.
+}
+
+// NewSampler returns a Sampler keeping up to max most recent samples of the
+// memory reported by retained. If interval is positive, a sample is taken
+// every interval until Stop is called and retained must be safe to call from
+// a different goroutine, like CCache.Stats is. Otherwise samples are taken
+// only by calling Sample. It panics with ErrInvalidSize if max is not
+// positive.
+//
+// The Clock option, if any, timestamps the samples and, if it's a TimerClock,
+// runs the periodic sampling. Other options are ignored.
+func NewSampler(retained func() int64, interval time.Duration, max int, opts ...Option) *Sampler {
+	if max <= 0 {
+		panic(fmt.Errorf("NewSampler: max %d: %w", max, ErrInvalidSize))
+	}
+
+	s := &Sampler{
+		clock:    NewOptions(opts...).Clock,
+		interval: interval,
+		retained: retained,
+		samples:  make([]Sample, 0, max),
+	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	if interval > 0 {
+		s.mu.Lock()
+		s.schedule()
+		s.mu.Unlock()
+	}
+	return s
+}
+
+// schedule arms the next periodic sample. s.mu must be held.
+func (s *Sampler) schedule() {
+	s.timer = afterFunc(s.clock, s.interval, func() {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+
+		s.running.Add(1)
+		s.mu.Unlock()
+
+		defer s.running.Done()
+
+		s.Sample()
+		s.mu.Lock()
+		if !s.stopped {
+			s.schedule()
+		}
+		s.mu.Unlock()
+	})
+}
+
+// Sample takes a sample and adds it to the timeline.
+func (s *Sampler) Sample() Sample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	r := Sample{
+		Time:      s.clock.Now(),
+		Retained:  s.retained(),
+		HeapAlloc: ms.HeapAlloc,
+		HeapInuse: ms.HeapInuse,
+		HeapSys:   ms.HeapSys,
+		Sys:       ms.Sys,
+	}
+
+	s.mu.Lock()
+	if len(s.samples) < cap(s.samples) {
+		s.samples = append(s.samples, r)
+	} else {
+		s.samples[s.n%len(s.samples)] = r
+	}
+	s.n++
+	s.mu.Unlock()
+	return r
+}
+
+// Snapshot returns the recorded samples, oldest first.
+func (s *Sampler) Snapshot() []Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := make([]Sample, 0, len(s.samples))
+	i := 0
+	if len(s.samples) == cap(s.samples) {
+		i = s.n % len(s.samples)
+	}
+	r = append(r, s.samples[i:]...)
+	return append(r, s.samples[:i]...)
+}
+
+// Stop stops periodic sampling. The timeline remains available.
+func (s *Sampler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	s.running.Wait()
+}
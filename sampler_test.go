@@ -0,0 +1,64 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSampler(t *testing.T) {
+	n := int64(0)
+	s := NewSampler(func() int64 { n++; return n }, 0, 3)
+	for i := 0; i < 5; i++ {
+		s.Sample()
+	}
+	a := s.Snapshot()
+	if g, e := len(a), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i, v := range a {
+		if g, e := v.Retained, int64(i+3); g != e {
+			t.Fatal(i, g, e)
+		}
+
+		if v.Sys == 0 {
+			t.Fatal(i)
+		}
+	}
+
+	var c CCache
+	c.Put(make([]byte, 100))
+	s = NewSampler(func() int64 { _, b := c.Stats64(); return b }, time.Millisecond, 10)
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	if a = s.Snapshot(); len(a) == 0 || a[0].Retained != 100 {
+		t.Fatal(a)
+	}
+
+	clock := &timerClock{now: time.Unix(1e9, 0)}
+	s = NewSampler(func() int64 { return 42 }, time.Minute, 10, WithClock(clock))
+	for i := 0; i < 3; i++ {
+		clock.advance(time.Minute)
+	}
+	s.Stop()
+	clock.advance(time.Minute)
+	a = s.Snapshot()
+	if g, e := len(a), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i, v := range a {
+		if g, e := v.Time, time.Unix(1e9, 0).Add(time.Duration(i+1)*time.Minute); !g.Equal(e) {
+			t.Fatal(i, g, e)
+		}
+	}
+
+	if err := recovered(func() { NewSampler(nil, 0, 0) }); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	scanStart    = 4096 // Initial size of the Scanner buffer.
+	scanMaxEmpty = 100  // Consecutive empty reads or tokens before giving up.
+)
+
+// Scanner is like bufio.Scanner, but its buffer is obtained from an Allocator
+// and it grows by replacing the buffer with a bigger one from the Allocator,
+// putting the old one back. Close puts the buffer back as well, so processing
+// many inputs, like log files, does not leave garbage behind. Tokens longer
+// than the maximum token size, see MaxTokenSize, fail the scan with an error
+// satisfying errors.Is(err, bufio.ErrTooLong).
+//
+// A Scanner is not safe for concurrent use by multiple goroutines.
+type Scanner struct {
+	a       Allocator
+	buf     []byte // Obtained from a.
+	empties int    // Consecutive empty tokens.
+	end     int    // End of the data in buf.
+	err     error  // Sticky error, io.EOF included.
+	max     int    // Maximum token size.
+	r       io.Reader
+	split   bufio.SplitFunc
+	start   int    // First unprocessed byte in buf.
+	token   []byte // Last token returned by split.
+
+	closed  bool
+	done    bool // Scan returns false from now on.
+	scanned bool // Scan was called.
+}
+
+// NewScanner returns a Scanner reading r, splitting it into lines by
+// bufio.ScanLines and allowing tokens of up to bufio.MaxScanTokenSize bytes.
+// The buffer is obtained from a. If a is nil, GCache is used.
+func NewScanner(r io.Reader, a Allocator) *Scanner {
+	if a == nil {
+		a = &GCache
+	}
+	return &Scanner{a: a, max: bufio.MaxScanTokenSize, r: r, split: bufio.ScanLines}
+}
+
+// Split sets the split function of s, see bufio.Scanner.Split. It panics with
+// ErrStarted if called after Scan.
+func (s *Scanner) Split(split bufio.SplitFunc) {
+	if s.scanned {
+		panic(fmt.Errorf("Scanner.Split: called after Scan: %w", ErrStarted))
+	}
+
+	s.split = split
+}
+
+// MaxTokenSize sets the maximum token size of s, which is also the maximum
+// size of its buffer. It panics with ErrStarted if called after Scan or with
+// ErrInvalidSize if n is not positive.
+func (s *Scanner) MaxTokenSize(n int) {
+	if s.scanned {
+		panic(fmt.Errorf("Scanner.MaxTokenSize: called after Scan: %w", ErrStarted))
+	}
+
+	if n <= 0 {
+		panic(fmt.Errorf("Scanner.MaxTokenSize: %d: %w", n, ErrInvalidSize))
+	}
+
+	s.max = n
+}
+
+// Bytes returns the most recent token produced by Scan. The underlying array
+// may be overwritten by a subsequent call to Scan or reused after Close.
+func (s *Scanner) Bytes() []byte { return s.token }
+
+// Text returns the most recent token produced by Scan as a newly allocated
+// string.
+func (s *Scanner) Text() string { return string(s.token) }
+
+// Err returns the first non-EOF error encountered by s.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// Scan advances s to the next token, which is then available through Bytes
+// or Text. It returns false when the scan stops, either by reaching the end
+// of the input or because of an error, see Err.
+func (s *Scanner) Scan() bool {
+	if s.closed {
+		s.setErr(fmt.Errorf("Scanner.Scan: %w", ErrClosed))
+		return false
+	}
+
+	if s.done {
+		return false
+	}
+
+	s.scanned = true
+	for {
+		if s.end > s.start || s.err != nil {
+			advance, token, err := s.split(s.buf[s.start:s.end], s.err != nil)
+			if err != nil {
+				if err == bufio.ErrFinalToken {
+					s.token, s.done = token, true
+					return token != nil
+				}
+
+				s.setErr(err)
+				return false
+			}
+
+			if !s.advance(advance) {
+				return false
+			}
+
+			s.token = token
+			if token != nil {
+				switch {
+				case s.err == nil || advance > 0:
+					s.empties = 0
+				default:
+					if s.empties++; s.empties > scanMaxEmpty {
+						s.setErr(io.ErrNoProgress)
+						s.token = nil
+						return false
+					}
+				}
+				return true
+			}
+		}
+
+		if s.err != nil {
+			s.start, s.end = 0, 0
+			return false
+		}
+
+		if s.start > 0 && (s.end == len(s.buf) || s.start > len(s.buf)/2) {
+			copy(s.buf, s.buf[s.start:s.end])
+			s.end -= s.start
+			s.start = 0
+		}
+
+		if s.end == len(s.buf) && !s.grow() {
+			return false
+		}
+
+		for empty := 0; ; {
+			n, err := s.r.Read(s.buf[s.end:])
+			if n < 0 || n > len(s.buf)-s.end {
+				s.setErr(fmt.Errorf("Scanner.Scan: %w", bufio.ErrBadReadCount))
+				break
+			}
+
+			s.end += n
+			if err != nil {
+				s.setErr(err)
+				break
+			}
+
+			if n > 0 {
+				s.empties = 0
+				break
+			}
+
+			if empty++; empty > scanMaxEmpty {
+				s.setErr(io.ErrNoProgress)
+				break
+			}
+		}
+	}
+}
+
+// grow replaces the full buffer of s by a bigger one obtained from s.a.
+func (s *Scanner) grow() bool {
+	if len(s.buf) >= s.max {
+		s.setErr(fmt.Errorf("Scanner.Scan: token longer than %d bytes: %w", s.max, bufio.ErrTooLong))
+		return false
+	}
+
+	n := scanStart
+	if len(s.buf) != 0 {
+		n = 2 * len(s.buf)
+	}
+	b := s.a.Get(min(n, s.max))
+	s.end = copy(b, s.buf[s.start:s.end])
+	s.start = 0
+	if s.buf != nil {
+		s.a.Put(s.buf)
+	}
+	s.buf = b
+	return true
+}
+
+func (s *Scanner) advance(n int) bool {
+	switch {
+	case n < 0:
+		s.setErr(fmt.Errorf("Scanner.Scan: %w", bufio.ErrNegativeAdvance))
+		return false
+	case n > s.end-s.start:
+		s.setErr(fmt.Errorf("Scanner.Scan: %w", bufio.ErrAdvanceTooFar))
+		return false
+	}
+
+	s.start += n
+	return true
+}
+
+func (s *Scanner) setErr(err error) {
+	if s.err == nil || s.err == io.EOF {
+		s.err = err
+	}
+}
+
+// Close puts the buffer of s back to its Allocator. The last token must not
+// be used afterwards. Close does not close the underlying io.Reader.
+func (s *Scanner) Close() error {
+	if s.closed {
+		return fmt.Errorf("Scanner.Close: %w", ErrClosed)
+	}
+
+	if s.buf != nil {
+		s.a.Put(s.buf)
+	}
+	s.buf, s.token, s.start, s.end, s.closed = nil, nil, 0, 0, true
+	return nil
+}
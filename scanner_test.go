@@ -0,0 +1,88 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanner(t *testing.T) {
+	var a []string
+	for i := range 100 {
+		a = append(a, strings.Repeat("x", i*i))
+	}
+	in := strings.Join(a, "\n")
+	for _, split := range []bufio.SplitFunc{bufio.ScanLines, bufio.ScanWords, bufio.ScanRunes} {
+		var c CCache
+		e := bufio.NewScanner(strings.NewReader(in))
+		e.Split(split)
+		s := NewScanner(iotest.HalfReader(strings.NewReader(in)), &c)
+		s.Split(split)
+		for e.Scan() {
+			if !s.Scan() {
+				t.Fatal(s.Err())
+			}
+
+			if g, e := s.Text(), e.Text(); g != e {
+				t.Fatalf("%.20q %.20q", g, e)
+			}
+		}
+		if s.Scan() || s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, _ := c.Stats(); n == 0 {
+			t.Fatal(n)
+		}
+
+		if s.Scan() || !errors.Is(s.Err(), ErrClosed) || !errors.Is(s.Close(), ErrClosed) {
+			t.Fatal(s.Err())
+		}
+	}
+
+	s := NewScanner(strings.NewReader("abc\n"+strings.Repeat("x", 100)+"\n"), nil)
+	s.MaxTokenSize(50)
+	if !s.Scan() || s.Text() != "abc" {
+		t.Fatal(s.Err())
+	}
+
+	if s.Scan() || !errors.Is(s.Err(), bufio.ErrTooLong) {
+		t.Fatal(s.Err())
+	}
+
+	for _, f := range []func(){
+		func() { s.MaxTokenSize(100) },
+		func() { s.Split(bufio.ScanWords) },
+	} {
+		if err := recovered(f); !errors.Is(err, ErrStarted) {
+			t.Fatal(err)
+		}
+	}
+
+	s.Close()
+}
+
+func TestScannerNoProgress(t *testing.T) {
+	s := NewScanner(strings.NewReader(""), nil)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) { return 0, []byte{}, nil })
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	if n == 0 || !errors.Is(s.Err(), io.ErrNoProgress) {
+		t.Fatal(n, s.Err())
+	}
+
+	s.Close()
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RequestScope groups the allocations made while serving a request. The
+// buffers are obtained from a shared Allocator, their combined length is
+// limited by a budget and they are all returned at once by Close.
+//
+// A RequestScope is safe for concurrent use by multiple goroutines if its
+// Allocator is.
+type RequestScope struct {
+	mu     sync.Mutex
+	a      Allocator
+	budget int
+	bufs   [][]byte
+	closed bool
+	peak   int
+	used   int
+}
+
+// NewRequestScope returns a newly created RequestScope allocating from a at
+// most budget bytes.
+func NewRequestScope(a Allocator, budget int) *RequestScope {
+	return &RequestScope{a: a, budget: budget}
+}
+
+// Alloc returns a buffer of length n obtained from the Allocator of s. The
+// buffer is valid until Close. If the budget would be exceeded, Alloc fails
+// with an error satisfying errors.Is(err, ErrTooLarge).
+func (s *RequestScope) Alloc(n int) ([]byte, error) {
+	checkSize("RequestScope.Alloc", n)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("RequestScope.Alloc: %w", ErrClosed)
+	}
+
+	if s.used+n > s.budget {
+		return nil, fmt.Errorf("RequestScope.Alloc: %d of %d bytes used, %d requested: %w", s.used, s.budget, n, ErrTooLarge)
+	}
+
+	b := s.a.Get(n)
+	s.bufs = append(s.bufs, b)
+	s.used += n
+	s.peak = max(s.peak, s.used)
+	return b, nil
+}
+
+// Used returns the combined length of the buffers allocated so far.
+func (s *RequestScope) Used() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used
+}
+
+// Close returns all buffers allocated by s to its Allocator and reports the
+// peak usage of s in bytes. The buffers must not be used afterwards.
+func (s *RequestScope) Close() (peak int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return s.peak, fmt.Errorf("RequestScope.Close: %w", ErrClosed)
+	}
+
+	for i, b := range s.bufs {
+		s.a.Put(b)
+		s.bufs[i] = nil
+	}
+	s.bufs, s.used, s.closed = nil, 0, true
+	return s.peak, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestScope(t *testing.T) {
+	var c CCache
+	s := NewRequestScope(&c, 100)
+	if _, err := s.Alloc(60); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Alloc(50); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Alloc(40); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := s.Used(), 100; g != e {
+		t.Fatal(g, e)
+	}
+
+	peak, err := s.Close()
+	if err != nil || peak != 100 {
+		t.Fatal(peak, err)
+	}
+
+	if n, _ := c.Stats(); n != 2 {
+		t.Fatal(n)
+	}
+
+	if _, err := s.Alloc(1); !errors.Is(err, ErrClosed) {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatal(err)
+	}
+}
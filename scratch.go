@@ -0,0 +1,124 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"io"
+)
+
+// Scratch is an append-only byte buffer like bytes.Buffer, with storage
+// obtained from an Allocator. It's intended as the io.Writer of streaming
+// encoders, like json.Encoder, in hot paths: create the encoder on the
+// Scratch once and reuse both, calling Reset between the uses.
+//
+//	var s bufs.Scratch // s.A = &cache
+//	enc := json.NewEncoder(&s)
+//	...
+//	s.Reset()
+//	if err := enc.Encode(v); err != nil { ... }
+//	w.Write(s.Bytes())
+//
+// Once the storage has grown to the size of the typical output, the encode
+// path makes no allocations besides those of the encoder itself. The storage
+// grows by getting a bigger buffer from A and putting the old one back.
+// Release returns the storage to A.
+//
+// The zero value of Scratch is ready for use, using GCache. A Scratch is not
+// safe for concurrent use by multiple goroutines.
+type Scratch struct {
+	// A is the source of the storage. If nil, GCache is used. Change it
+	// only while the Scratch holds no storage, ie. initially or after
+	// Release.
+	A Allocator
+
+	buf []byte
+}
+
+var (
+	_ io.Writer       = (*Scratch)(nil)
+	_ io.StringWriter = (*Scratch)(nil)
+	_ io.ByteWriter   = (*Scratch)(nil)
+	_ io.WriterTo     = (*Scratch)(nil)
+)
+
+func (s *Scratch) allocator() Allocator {
+	if s.A == nil {
+		return &GCache
+	}
+
+	return s.A
+}
+
+// Bytes returns the written data. The result is valid until the next call of
+// a method modifying s.
+func (s *Scratch) Bytes() []byte { return s.buf }
+
+// String returns the written data as a string.
+func (s *Scratch) String() string { return string(s.buf) }
+
+// Len returns the number of written bytes.
+func (s *Scratch) Len() int { return len(s.buf) }
+
+// Cap returns the capacity of the storage.
+func (s *Scratch) Cap() int { return cap(s.buf) }
+
+// Reset discards the written data, keeping the storage.
+func (s *Scratch) Reset() { s.buf = s.buf[:0] }
+
+// Release discards the written data and returns the storage to the
+// allocator. The Scratch remains usable.
+func (s *Scratch) Release() {
+	if s.buf != nil {
+		s.allocator().Put(s.buf)
+		s.buf = nil
+	}
+}
+
+// Grow makes sure another n bytes can be written without growing the
+// storage.
+func (s *Scratch) Grow(n int) {
+	if len(s.buf)+n <= cap(s.buf) {
+		return
+	}
+
+	a := s.allocator()
+	r := a.Get(max(len(s.buf)+n, 2*cap(s.buf)))
+	r = r[:copy(r, s.buf)]
+	if s.buf != nil {
+		a.Put(s.buf)
+	}
+	s.buf = r
+}
+
+// Write implements io.Writer. It never returns an error.
+func (s *Scratch) Write(p []byte) (int, error) {
+	s.Grow(len(p))
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// WriteString implements io.StringWriter. It never returns an error.
+func (s *Scratch) WriteString(p string) (int, error) {
+	s.Grow(len(p))
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// WriteByte implements io.ByteWriter. It never returns an error.
+func (s *Scratch) WriteByte(c byte) error {
+	s.Grow(1)
+	s.buf = append(s.buf, c)
+	return nil
+}
+
+// WriteTo implements io.WriterTo. It writes the data to w and, unless an error
+// occurs, resets s.
+func (s *Scratch) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s.buf)
+	if err == nil {
+		s.Reset()
+	}
+	return int64(n), err
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestScratch(t *testing.T) {
+	var c CCache
+	s := Scratch{A: &c}
+	s.WriteString("foo")
+	s.WriteByte(' ')
+	s.Write([]byte(strings.Repeat("x", 100)))
+	if g, e := s.String(), "foo "+strings.Repeat("x", 100); g != e {
+		t.Fatal(g, e)
+	}
+
+	if n, _ := c.Stats(); n != 1 {
+		t.Fatal(n) // The storage grew once.
+	}
+
+	s.Release()
+	if n, _ := c.Stats(); n != 2 || s.Len() != 0 {
+		t.Fatal(n, s.Len())
+	}
+}
+
+func TestScratchJSON(t *testing.T) {
+	type T struct {
+		A int
+		B string
+	}
+
+	var s Scratch
+	enc := json.NewEncoder(&s)
+	v := &T{42, "foo"}
+	encode := func() {
+		s.Reset()
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.WriteTo(io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encode()
+	if raceEnabled {
+		t.Skip("allocations not reliable with the race detector")
+	}
+
+	if g := testing.AllocsPerRun(100, encode); g != 0 {
+		t.Fatal(g)
+	}
+}
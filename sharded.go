@@ -0,0 +1,171 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedCache is a Cache split into independently locked shards to reduce
+// lock contention. Every Get and Put uses a randomly chosen shard. When the
+// chosen shard has no buffer of sufficient size, Get steals one from a
+// sibling shard before allocating a new one, which keeps the hit rate high
+// under bursty, unbalanced load.
+//
+// A ShardedCache is safe for concurrent use by multiple goroutines. See Cache
+// for the handling of zero length requests and buffers.
+type ShardedCache struct {
+	shards  atomic.Pointer[[]shard]
+	elastic atomic.Bool
+	mu      sync.Mutex // Serializes Resize.
+	ops     atomic.Uint64
+	steals  atomic.Uint64
+}
+
+type shard struct {
+	mu sync.Mutex
+	c  Cache
+	_  [64]byte // Avoid false sharing of the mutexes.
+}
+
+// elasticPeriod is the number of Puts between checks of GOMAXPROCS by an
+// elastic ShardedCache.
+const elasticPeriod = 1024
+
+// NewShardedCache returns a newly created ShardedCache with n shards. If n is
+// not positive, the cache is elastic: it has runtime.GOMAXPROCS(0) shards and
+// follows changes of GOMAXPROCS made at runtime, checking it every now and
+// then, so a process limited to fewer CPUs does not retain buffers in
+// superfluous shards. See Resize.
+func NewShardedCache(n int) *ShardedCache {
+	c := &ShardedCache{}
+	if n <= 0 {
+		c.elastic.Store(true)
+		n = runtime.GOMAXPROCS(0)
+	}
+	shards := make([]shard, n)
+	c.shards.Store(&shards)
+	return c
+}
+
+// Shards returns the current number of shards.
+func (c *ShardedCache) Shards() int { return len(*c.shards.Load()) }
+
+// Resize changes the number of shards to n, which must be positive. The
+// buffers of the removed shards are dropped. Resize makes an elastic cache
+// fixed, see NewShardedCache.
+func (c *ShardedCache) Resize(n int) {
+	if n <= 0 {
+		panic(fmt.Errorf("ShardedCache.Resize: %d shards: %w", n, ErrInvalidSize))
+	}
+
+	c.mu.Lock()
+	c.elastic.Store(false)
+	c.resize(n)
+	c.mu.Unlock()
+}
+
+// resize changes the number of shards to n. It must be called with c.mu held.
+func (c *ShardedCache) resize(n int) {
+	old := *c.shards.Load()
+	if n == len(old) {
+		return
+	}
+
+	shards := make([]shard, n)
+	for i := range min(n, len(old)) {
+		s := &old[i]
+		s.mu.Lock()
+		shards[i].c, s.c = s.c, nil
+		s.mu.Unlock()
+	}
+	c.shards.Store(&shards)
+}
+
+// adapt follows a change of GOMAXPROCS, if c is elastic.
+func (c *ShardedCache) adapt() {
+	c.mu.Lock()
+	if c.elastic.Load() {
+		c.resize(runtime.GOMAXPROCS(0))
+	}
+	c.mu.Unlock()
+}
+
+// Get returns a buffer of length n, see Cache.Get. The buffer is taken from
+// the chosen shard, stolen from a sibling shard or newly allocated, in this
+// order of preference.
+//
+// NOTE: The buffer returned by Get _is not guaranteed_ to be zeroed.
+func (c *ShardedCache) Get(n int) []byte {
+	checkSize("ShardedCache.Get", n)
+	if r, ok := c.TryGet(n); ok {
+		return r
+	}
+
+	return make([]byte, n, overCommit(n))
+}
+
+// TryGet is like Get, but it never allocates a new buffer. If no shard has a
+// buffer of sufficient size, TryGet reports false.
+func (c *ShardedCache) TryGet(n int) ([]byte, bool) {
+	checkSize("ShardedCache.TryGet", n)
+	if n == 0 {
+		return []byte{}, true
+	}
+
+	shards := *c.shards.Load()
+	i := rand.N(len(shards))
+	for j := range shards {
+		s := &shards[(i+j)%len(shards)]
+		s.mu.Lock()
+		r, ok := s.c.TryGet(n)
+		s.mu.Unlock()
+		if ok {
+			if j != 0 {
+				c.steals.Add(1)
+			}
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Put caches b in a randomly chosen shard, see Cache.Put.
+func (c *ShardedCache) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	shards := *c.shards.Load()
+	s := &shards[rand.N(len(shards))]
+	s.mu.Lock()
+	s.c.Put(b)
+	s.mu.Unlock()
+	if c.ops.Add(1)%elasticPeriod == 0 && c.elastic.Load() {
+		c.adapt()
+	}
+}
+
+// Steals reports the number of buffers Get and TryGet took from a sibling
+// shard.
+func (c *ShardedCache) Steals() uint64 { return c.steals.Load() }
+
+// Stats reports memory consumed by a ShardedCache, see Cache.Stats.
+func (c *ShardedCache) Stats() (n int, bytes int64) {
+	shards := *c.shards.Load()
+	for i := range shards {
+		s := &shards[i]
+		s.mu.Lock()
+		sn, sbytes := s.c.Stats64()
+		s.mu.Unlock()
+		n += sn
+		bytes += sbytes
+	}
+	return n, bytes
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	c := NewShardedCache(8)
+	b := c.Get(100)
+	c.Put(b)
+	for range 100 {
+		// Whichever shard is chosen, the buffer is found.
+		r, ok := c.TryGet(50)
+		if !ok || &r[0] != &b[0] {
+			t.Fatal(ok)
+		}
+
+		c.Put(r)
+	}
+	if c.Steals() == 0 {
+		t.Fatal("no steals")
+	}
+
+	if n, bytes := c.Stats(); n != 1 || bytes != int64(cap(b)) {
+		t.Fatal(n, bytes)
+	}
+}
+
+func TestShardedCacheElastic(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	c := NewShardedCache(0)
+	if g, e := c.Shards(), 4; g != e {
+		t.Fatal(g, e)
+	}
+
+	runtime.GOMAXPROCS(2)
+	for range elasticPeriod {
+		c.Put(c.Get(1))
+	}
+	if g, e := c.Shards(), 2; g != e {
+		t.Fatal(g, e)
+	}
+
+	// An explicit size overrides GOMAXPROCS.
+	c.Resize(3)
+	runtime.GOMAXPROCS(5)
+	for range elasticPeriod {
+		c.Put(c.Get(1))
+	}
+	if g, e := c.Shards(), 3; g != e {
+		t.Fatal(g, e)
+	}
+}
+
+func BenchmarkShardedCacheParallel(b *testing.B) {
+	c := NewShardedCache(0)
+	benchmarkConcurrent(b, c.Get, c.Put)
+}
@@ -0,0 +1,260 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	shmMagic      = 0x62756673 // "bufs"
+	shmHeaderSize = 16         // magic, page size, pages, reserved: 4 x uint32.
+)
+
+// ShmPool is a pool of fixed size pages in shared memory. Multiple processes
+// on one host can open the same ShmPool by name. A page allocated by one
+// process can be released by another one, the pages are identified by their
+// index which is the same in all processes. The allocation state is kept in a
+// bitmap in the shared memory itself and is updated using atomic operations,
+// so ShmPool is also safe for concurrent use by multiple goroutines.
+//
+// ShmPool is currently supported on Linux only, where it's backed by a file
+// in /dev/shm, the same way POSIX shm_open does.
+type ShmPool struct {
+	bitmap   []uint32
+	f        *os.File
+	mem      []byte // The whole mapping.
+	pages    []byte
+	pageSize int
+	n        int // Number of pages.
+}
+
+// shmCheck reports whether n pages of pageSize bytes are a valid ShmPool
+// geometry.
+func shmCheck(pageSize, n int) error {
+	if pageSize <= 0 || n <= 0 || n > 1<<30 || uint64(pageSize) > 1<<31 {
+		return fmt.Errorf("ShmPool: invalid geometry %d x %d: %w", pageSize, n, ErrInvalidSize)
+	}
+
+	if _, size := shmLayout(pageSize, n); size > math.MaxInt {
+		return fmt.Errorf("ShmPool: geometry %d x %d needs %d bytes: %w", pageSize, n, size, ErrInvalidSize)
+	}
+
+	return nil
+}
+
+// shmLayout returns the offset of the first page and the total size of a
+// ShmPool. Pages start at a multiple of the OS page size. The size is computed
+// in int64, it can exceed the range of int on 32-bit platforms, see shmCheck.
+func shmLayout(pageSize, n int) (pagesOff int, size int64) {
+	words := (n + 31) / 32
+	osPage := os.Getpagesize()
+	pagesOff = (shmHeaderSize + 4*words + osPage - 1) / osPage * osPage
+	return pagesOff, int64(pagesOff) + int64(pageSize)*int64(n)
+}
+
+// init initializes p from the mapping mem. If create is set, the header is
+// written, otherwise it's verified.
+func (p *ShmPool) init(mem []byte, pageSize, n int, create bool) error {
+	if err := shmCheck(pageSize, n); err != nil {
+		return err
+	}
+
+	pagesOff, size := shmLayout(pageSize, n)
+	if int64(len(mem)) < size {
+		return fmt.Errorf("ShmPool: mapping too small: %d < %d", len(mem), size)
+	}
+
+	magic := (*uint32)(unsafe.Pointer(&mem[0]))
+	if create {
+		binary.LittleEndian.PutUint32(mem[4:], uint32(pageSize))
+		binary.LittleEndian.PutUint32(mem[8:], uint32(n))
+		atomic.StoreUint32(magic, shmMagic)
+	} else {
+		if atomic.LoadUint32(magic) != shmMagic {
+			return errors.New("ShmPool: not a pool or not initialized yet")
+		}
+
+		if g, h := binary.LittleEndian.Uint32(mem[4:]), binary.LittleEndian.Uint32(mem[8:]); int(g) != pageSize || int(h) != n {
+			return fmt.Errorf("ShmPool: geometry mismatch: have %d x %d, want %d x %d", g, h, pageSize, n)
+		}
+	}
+
+	p.mem = mem
+	p.bitmap = unsafe.Slice((*uint32)(unsafe.Pointer(&mem[shmHeaderSize])), (n+31)/32)
+	p.pages = mem[pagesOff:int(size)]
+	p.pageSize = pageSize
+	p.n = n
+	return nil
+}
+
+// Alloc allocates a free page and returns its index and content. It returns
+// an error satisfying errors.Is(err, ErrExhausted) if no page is free.
+//
+// NOTE: The page _is not_ zeroed.
+func (p *ShmPool) Alloc() (index int, page []byte, err error) {
+	for i := range p.bitmap {
+		w := &p.bitmap[i]
+		for {
+			v := atomic.LoadUint32(w)
+			if v == 1<<32-1 {
+				break
+			}
+
+			bit := 0
+			for v&(1<<bit) != 0 {
+				bit++
+			}
+			if index = 32*i + bit; index >= p.n {
+				break
+			}
+
+			if atomic.CompareAndSwapUint32(w, v, v|1<<bit) {
+				return index, p.Page(index), nil
+			}
+		}
+	}
+	return -1, nil, fmt.Errorf("ShmPool.Alloc: %w", ErrExhausted)
+}
+
+// Page returns the content of the page at index.
+func (p *ShmPool) Page(index int) []byte {
+	off := index * p.pageSize
+	return p.pages[off : off+p.pageSize : off+p.pageSize]
+}
+
+// Free releases the page at index. It returns an error satisfying
+// errors.Is(err, ErrDoubleFree) if the page is not allocated.
+func (p *ShmPool) Free(index int) error {
+	if index < 0 || index >= p.n {
+		return fmt.Errorf("ShmPool.Free: invalid index %d", index)
+	}
+
+	w, bit := &p.bitmap[index/32], uint32(1)<<(index%32)
+	for {
+		v := atomic.LoadUint32(w)
+		if v&bit == 0 {
+			return fmt.Errorf("ShmPool.Free: page %d: %w", index, ErrDoubleFree)
+		}
+
+		if atomic.CompareAndSwapUint32(w, v, v&^bit) {
+			return nil
+		}
+	}
+}
+
+// AllocSpan allocates a span of contiguous free pages covering size bytes and
+// returns the index of its first page and its content. The allocation
+// granularity is the page size of the pool. AllocSpan returns an error
+// satisfying errors.Is(err, ErrExhausted) if there's no sufficiently long run
+// of free pages and errors.Is(err, ErrTooLarge) if the pool is too small.
+//
+// NOTE: The span _is not_ zeroed.
+func (p *ShmPool) AllocSpan(size int) (index int, span []byte, err error) {
+	checkSize("ShmPool.AllocSpan", size)
+	n := p.spanPages(size)
+	if n > p.n {
+		return -1, nil, fmt.Errorf("ShmPool.AllocSpan: %d bytes: %w", size, ErrTooLarge)
+	}
+
+	for i := 0; i+n <= p.n; {
+		j := i
+		for j < i+n && !p.allocated(j) {
+			j++
+		}
+		if j < i+n {
+			i = j + 1
+			continue
+		}
+
+		k := i
+		for k < i+n && p.set(k) {
+			k++
+		}
+		if k == i+n {
+			lo, hi := i*p.pageSize, (i+n)*p.pageSize
+			return i, p.pages[lo:hi:hi], nil
+		}
+
+		// Lost a race, roll back.
+		for j := i; j < k; j++ {
+			p.Free(j)
+		}
+		i = k + 1
+	}
+	return -1, nil, fmt.Errorf("ShmPool.AllocSpan: %d bytes: %w", size, ErrExhausted)
+}
+
+// FreeSpan releases the span of size bytes at index allocated by AllocSpan.
+func (p *ShmPool) FreeSpan(index, size int) error {
+	n := p.spanPages(size)
+	for i := index; i < index+n; i++ {
+		if err := p.Free(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spanPages returns the number of pages of a span of size bytes.
+func (p *ShmPool) spanPages(size int) int { return max((size+p.pageSize-1)/p.pageSize, 1) }
+
+// allocated reports whether the page at index is allocated.
+func (p *ShmPool) allocated(index int) bool {
+	return atomic.LoadUint32(&p.bitmap[index/32])&(1<<(index%32)) != 0
+}
+
+// set marks the page at index as allocated and reports whether it was free.
+func (p *ShmPool) set(index int) bool {
+	w, bit := &p.bitmap[index/32], uint32(1)<<(index%32)
+	for {
+		v := atomic.LoadUint32(w)
+		if v&bit != 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapUint32(w, v, v|bit) {
+			return true
+		}
+	}
+}
+
+// Fragmentation reports the number of free pages, the number of runs of
+// adjacent free pages they form and the length of the longest run, which
+// limits the size of a span AllocSpan can allocate. The free runs are always
+// coalesced, the allocated pages cannot be moved as they are referred to by
+// index.
+func (p *ShmPool) Fragmentation() (free, runs, longest int) {
+	run := 0
+	for i := 0; i < p.n; i++ {
+		if p.allocated(i) {
+			run = 0
+			continue
+		}
+
+		if free++; run == 0 {
+			runs++
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return free, runs, longest
+}
+
+// Stats reports the number of pages and how many of them are allocated.
+func (p *ShmPool) Stats() (pages, allocated int) {
+	for i := range p.bitmap {
+		for v := atomic.LoadUint32(&p.bitmap[i]); v != 0; v &= v - 1 {
+			allocated++
+		}
+	}
+	return p.n, allocated
+}
@@ -0,0 +1,214 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+func shmPath(name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, '/') {
+		return "", errors.New("ShmPool: invalid name")
+	}
+
+	return filepath.Join("/dev/shm", name), nil
+}
+
+// OpenShmPool opens the ShmPool 'name' of n pages of pageSize bytes. The
+// pool is created if it does not exist yet. All processes must use the same
+// pageSize and n. Invalid pageSize or n fail with an error satisfying
+// errors.Is(err, ErrInvalidSize).
+//
+// A new pool is sized and initialized under a temporary name and then linked
+// to 'name', so other processes never see it partially created.
+func OpenShmPool(name string, pageSize, n int) (*ShmPool, error) {
+	path, err := shmPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := shmCheck(pageSize, n); err != nil {
+		return nil, err
+	}
+
+	for {
+		p, err := openShm(path, pageSize, n)
+		if !os.IsNotExist(err) {
+			return p, err
+		}
+
+		if p, err = createShm(path, pageSize, n); !os.IsExist(err) {
+			return p, err
+		}
+
+		// Lost the race to another creator, open its pool.
+	}
+}
+
+// openShm maps the existing pool at path.
+func openShm(path string, pageSize, n int) (*ShmPool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, size := shmLayout(pageSize, n)
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if fi.Size() < size {
+		f.Close()
+		return nil, fmt.Errorf("ShmPool: size %d, want %d: geometry mismatch", fi.Size(), size)
+	}
+
+	return mapShm(f, pageSize, n, false)
+}
+
+// createShm creates, initializes and maps a new pool, linking it to path
+// when it's ready. If path exists, the returned error satisfies
+// os.IsExist.
+func createShm(path string, pageSize, n int) (*ShmPool, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(f.Name())
+
+	_, size := shmLayout(pageSize, n)
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	p, err := mapShm(f, pageSize, n, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Link(f.Name(), path); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// mapShm maps f, which has at least the size of the pool, and initializes or
+// verifies the header. f is closed on error.
+func mapShm(f *os.File, pageSize, n int, create bool) (*ShmPool, error) {
+	_, size := shmLayout(pageSize, n)
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	p := &ShmPool{f: f}
+	if err = p.init(mem, pageSize, n, create); err != nil {
+		syscall.Munmap(mem)
+		f.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Close unmaps the pool. Pages obtained from p must not be used afterwards.
+// The pool continues to exist, see RemoveShmPool.
+func (p *ShmPool) Close() error {
+	err := syscall.Munmap(p.mem)
+	if err2 := p.f.Close(); err == nil {
+		err = err2
+	}
+	p.mem, p.pages, p.bitmap = nil, nil, nil
+	return err
+}
+
+// Decommit returns the memory of free pages to the OS and reports how many
+// bytes were released. The pages read as zeros when allocated again. Only
+// whole OS pages can be released, so pages smaller than the OS page size are
+// released only when adjacent free pages cover whole OS pages.
+//
+// While Decommit runs, the free pages are temporarily marked as allocated, so
+// concurrent Alloc calls, including those made by other processes, may
+// report the pool is exhausted.
+func (p *ShmPool) Decommit() (int, error) {
+	claimed := make([]uint32, len(p.bitmap))
+	for i := range p.bitmap {
+		claimed[i] = p.claim(i)
+	}
+
+	defer func() {
+		for i, c := range claimed {
+			for w := &p.bitmap[i]; ; {
+				v := atomic.LoadUint32(w)
+				if atomic.CompareAndSwapUint32(w, v, v&^c) {
+					break
+				}
+			}
+		}
+	}()
+
+	osPage := os.Getpagesize()
+	released := 0
+	for i := 0; i < p.n; {
+		if claimed[i/32]&(1<<(i%32)) == 0 {
+			i++
+			continue
+		}
+
+		j := i
+		for j < p.n && claimed[j/32]&(1<<(j%32)) != 0 {
+			j++
+		}
+		lo := (i*p.pageSize + osPage - 1) / osPage * osPage
+		hi := j * p.pageSize / osPage * osPage
+		if lo < hi {
+			if err := syscall.Madvise(p.pages[lo:hi], syscall.MADV_REMOVE); err != nil {
+				return released, err
+			}
+
+			released += hi - lo
+		}
+		i = j
+	}
+	return released, nil
+}
+
+// claim marks all free pages tracked by p.bitmap[i] as allocated and returns
+// the bits of the pages claimed.
+func (p *ShmPool) claim(i int) uint32 {
+	valid := uint32(1<<32 - 1)
+	if rem := p.n - 32*i; rem < 32 {
+		valid = 1<<rem - 1
+	}
+	for w := &p.bitmap[i]; ; {
+		v := atomic.LoadUint32(w)
+		if atomic.CompareAndSwapUint32(w, v, v|valid) {
+			return valid &^ v
+		}
+	}
+}
+
+// RemoveShmPool removes the ShmPool 'name'. Processes having the pool open
+// can continue to use it.
+func RemoveShmPool(name string) error {
+	path, err := shmPath(name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
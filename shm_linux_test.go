@@ -0,0 +1,214 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestShmPool(t *testing.T) {
+	name := fmt.Sprintf("bufs-test-%d", os.Getpid())
+	a, err := OpenShmPool(name, 100, 40)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer RemoveShmPool(name)
+	defer a.Close()
+
+	b, err := OpenShmPool(name, 100, 40) // Another "process".
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	if _, err := OpenShmPool(name, 100, 41); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	var idx []int
+	for i := 0; i < 40; i++ {
+		j, page, err := a.Alloc()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		page[0] = byte(j)
+		idx = append(idx, j)
+	}
+	if _, _, err := b.Alloc(); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+
+	if n, allocated := b.Stats(); n != 40 || allocated != 40 {
+		t.Fatal(n, allocated)
+	}
+
+	for _, j := range idx {
+		if g, e := b.Page(j)[0], byte(j); g != e {
+			t.Fatal(g, e)
+		}
+
+		if err := b.Free(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Free(idx[0]); !errors.Is(err, ErrDoubleFree) {
+		t.Fatal(err)
+	}
+
+	if _, allocated := a.Stats(); allocated != 0 {
+		t.Fatal(allocated)
+	}
+}
+
+func TestShmPoolDecommit(t *testing.T) {
+	name := fmt.Sprintf("bufs-test-decommit-%d", os.Getpid())
+	ps := os.Getpagesize()
+	p, err := OpenShmPool(name, ps, 4)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer RemoveShmPool(name)
+	defer p.Close()
+
+	for i := 0; i < 4; i++ {
+		_, page, _ := p.Alloc()
+		page[0] = 42
+	}
+	p.Free(1)
+	p.Free(2)
+	n, err := p.Decommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := n, 2*ps; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := p.Page(1)[0], byte(0); g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := p.Page(3)[0], byte(42); g != e {
+		t.Fatal(g, e)
+	}
+
+	if _, allocated := p.Stats(); allocated != 2 {
+		t.Fatal(allocated)
+	}
+}
+
+func TestShmPoolSpan(t *testing.T) {
+	name := fmt.Sprintf("bufs-test-span-%d", os.Getpid())
+	p, err := OpenShmPool(name, 100, 10)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer RemoveShmPool(name)
+	defer p.Close()
+
+	i, span, err := p.AllocSpan(250)
+	if err != nil || i != 0 || len(span) != 300 {
+		t.Fatal(i, len(span), err)
+	}
+
+	j, _, _ := p.Alloc()
+	if _, _, err := p.AllocSpan(100 * 7); !errors.Is(err, ErrExhausted) {
+		t.Fatal(err)
+	}
+
+	if _, _, err := p.AllocSpan(100 * 11); !errors.Is(err, ErrTooLarge) {
+		t.Fatal(err)
+	}
+
+	if free, runs, longest := p.Fragmentation(); free != 6 || runs != 1 || longest != 6 {
+		t.Fatal(free, runs, longest)
+	}
+
+	if err := p.FreeSpan(i, 250); err != nil {
+		t.Fatal(err)
+	}
+
+	if free, runs, longest := p.Fragmentation(); free != 9 || runs != 2 || longest != 6 {
+		t.Fatal(free, runs, longest)
+	}
+
+	p.Free(j)
+	if _, _, err := p.AllocSpan(100 * 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShmPoolOpen(t *testing.T) {
+	name := fmt.Sprintf("bufs-test-open-%d", os.Getpid())
+	for _, v := range [][2]int{{0, 1}, {1, 0}, {-1, 1}, {1, 1<<30 + 1}} {
+		if _, err := OpenShmPool(name, v[0], v[1]); !errors.Is(err, ErrInvalidSize) {
+			t.Fatal(v, err)
+		}
+	}
+	if _, err := os.Stat("/dev/shm/" + name); !os.IsNotExist(err) {
+		t.Fatal("created a pool of invalid geometry", err)
+	}
+
+	if _, size := shmLayout(1<<30, 1<<30); size < 1<<60 {
+		t.Fatal("layout overflow", size)
+	} else if err := shmCheck(1<<30, 1<<30); (size > math.MaxInt) != errors.Is(err, ErrInvalidSize) {
+		t.Fatal(size, err)
+	}
+
+	const n = 16
+	pools := make([]*ShmPool, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pools[i], errs[i] = OpenShmPool(name, 100, 40)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Skip(i, err)
+		}
+	}
+
+	defer RemoveShmPool(name)
+	for _, p := range pools {
+		defer p.Close()
+	}
+
+	i, _, err := pools[0].Alloc()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, allocated := pools[n-1].Stats(); allocated != 1 {
+		t.Fatal(allocated)
+	}
+
+	pools[n-1].Free(i)
+
+	// Bigger than the segment, must not map past its end.
+	if _, err := OpenShmPool(name, 100, 4000); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	if m, _ := filepath.Glob("/dev/shm/." + name + ".*"); len(m) != 0 {
+		t.Fatal("temporary files left", m)
+	}
+}
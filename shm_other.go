@@ -0,0 +1,39 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package bufs
+
+import (
+	"errors"
+)
+
+var errShmNotSupported = errors.New("ShmPool: not supported on this platform")
+
+// OpenShmPool opens the ShmPool 'name' of n pages of pageSize bytes. The
+// pool is created if it does not exist yet. All processes must use the same
+// pageSize and n. Invalid pageSize or n fail with an error satisfying
+// errors.Is(err, ErrInvalidSize).
+//
+// On this platform valid pageSize and n fail as not supported.
+func OpenShmPool(name string, pageSize, n int) (*ShmPool, error) {
+	if err := shmCheck(pageSize, n); err != nil {
+		return nil, err
+	}
+
+	return nil, errShmNotSupported
+}
+
+// Close unmaps the pool. Pages obtained from p must not be used afterwards.
+// The pool continues to exist, see RemoveShmPool.
+func (p *ShmPool) Close() error { return errShmNotSupported }
+
+// Decommit returns the memory of free pages to the OS and reports how many
+// bytes were released.
+func (p *ShmPool) Decommit() (int, error) { return 0, errShmNotSupported }
+
+// RemoveShmPool removes the ShmPool 'name'. Processes having the pool open
+// can continue to use it.
+func RemoveShmPool(name string) error { return errShmNotSupported }
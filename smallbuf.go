@@ -0,0 +1,75 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+)
+
+// Limits of SmallBuf.
+const (
+	SmallBufSize = 256 // Size of the inline storage.
+	SmallBufMax  = 64  // Largest request served from the inline storage.
+)
+
+// SmallBuf serves tiny allocations, up to SmallBufMax bytes, by bump
+// allocation from an inline array of SmallBufSize bytes, falling back to its
+// Stack for larger requests or when the inline storage is used up. The
+// tiny allocations then touch neither the heap nor the slots.
+//
+// Alloc and Free follow the same nesting discipline as with Stack: Free
+// frees the lastly made and not yet freed Alloc, whichever storage served
+// it.
+//
+// A SmallBuf must not be copied after first use. It's not safe for concurrent
+// use by multiple goroutines.
+type SmallBuf struct {
+	b      *Stack
+	stack  []int // Per allocation: offset before the allocation, -1 if served by b.
+	off    int   // Bump pointer into inline.
+	inline [SmallBufSize]byte
+}
+
+// NewSmallBuf returns a newly created SmallBuf falling back to b.
+func NewSmallBuf(b *Stack) *SmallBuf { return &SmallBuf{b: b} }
+
+// Alloc returns a buffer of length n. Buffers served from the inline storage
+// have their capacity limited to n. See Stack.Alloc for the rules of using
+// the buffer.
+//
+// NOTE: The buffer returned by Alloc _is not_ zeroed.
+func (s *SmallBuf) Alloc(n int) []byte {
+	checkSize("SmallBuf.Alloc", n)
+	if n > SmallBufMax || s.off+n > len(s.inline) {
+		r := s.b.Alloc(n)
+		s.stack = append(s.stack, -1)
+		return r
+	}
+
+	off := s.off
+	s.off += n
+	s.stack = append(s.stack, off)
+	return s.inline[off:s.off:s.off]
+}
+
+// Free makes the lastly allocated by Alloc buffer free (available) again.
+// Improper Free invocations will panic.
+func (s *SmallBuf) Free() {
+	if len(s.stack) == 0 {
+		panic(fmt.Errorf("SmallBuf.Free: %w", ErrDoubleFree))
+	}
+
+	off := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	if off < 0 {
+		s.b.Free()
+		return
+	}
+
+	s.off = off
+}
+
+// Inline returns the number of inline bytes in use.
+func (s *SmallBuf) Inline() int { return s.off }
@@ -0,0 +1,55 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSmallBuf(t *testing.T) {
+	b := NewStack(2)
+	s := NewSmallBuf(&b)
+	x := s.Alloc(10)
+	y := s.Alloc(100) // Too big.
+	z := s.Alloc(SmallBufMax)
+	if g, e := s.Inline(), 10+SmallBufMax; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := b.Depth(), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if cap(x) != 10 || len(y) != 100 || cap(z) != SmallBufMax {
+		t.Fatal(cap(x), len(y), cap(z))
+	}
+
+	s.Free()
+	s.Free()
+	s.Free()
+	if s.Inline() != 0 || b.Depth() != 0 {
+		t.Fatal(s.Inline(), b.Depth())
+	}
+
+	for i := 0; i < SmallBufSize/SmallBufMax; i++ {
+		s.Alloc(SmallBufMax)
+	}
+	s.Alloc(1) // Inline storage used up.
+	if g, e := b.Depth(), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	for i := 0; i <= SmallBufSize/SmallBufMax; i++ {
+		s.Free()
+	}
+	if err := recovered(s.Free); !errors.Is(err, ErrDoubleFree) {
+		t.Fatal(err)
+	}
+
+	if g := testing.AllocsPerRun(100, func() { s.Alloc(32); s.Free() }); g != 0 {
+		t.Fatal(g)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+)
+
+// SortRecords sorts data, a sequence of records of size bytes each, like
+// fixed size keys, in the order defined by cmp. The sort is stable. It's a
+// merge sort taking its temporary space, as much as len(data), from a instead
+// of allocating it per call. If a is nil, GCache is used.
+//
+// cmp must return a negative number when a < b, a positive number when
+// a > b and zero when a == b. SortRecords panics with an error satisfying
+// errors.Is(err, ErrInvalidSize) if size is not positive or if len(data) is
+// not a multiple of size.
+func SortRecords(data []byte, size int, cmp func(a, b []byte) int, a Allocator) {
+	if size <= 0 || len(data)%size != 0 {
+		panic(fmt.Errorf("SortRecords: %d bytes, record size %d: %w", len(data), size, ErrInvalidSize))
+	}
+
+	if len(data) <= size {
+		return
+	}
+
+	if a == nil {
+		a = &GCache
+	}
+	tmp := a.Get(len(data))
+	defer a.Put(tmp)
+
+	src, dst := data, tmp
+	for w := size; w < len(data); w *= 2 {
+		for lo := 0; lo < len(data); lo += 2 * w {
+			mid := min(lo+w, len(data))
+			hi := min(lo+2*w, len(data))
+			mergeRecords(dst[lo:hi], src[lo:mid], src[mid:hi], size, cmp)
+		}
+		src, dst = dst, src
+	}
+	if &src[0] != &data[0] {
+		copy(data, src)
+	}
+}
+
+// mergeRecords merges the sorted records of x and y into dst. Equal records
+// of x come first.
+func mergeRecords(dst, x, y []byte, size int, cmp func(a, b []byte) int) {
+	for len(x) != 0 && len(y) != 0 {
+		switch {
+		case cmp(y[:size], x[:size]) < 0:
+			dst = dst[copy(dst, y[:size]):]
+			y = y[size:]
+		default:
+			dst = dst[copy(dst, x[:size]):]
+			x = x[size:]
+		}
+	}
+	copy(dst[copy(dst, x):], y)
+}
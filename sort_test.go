@@ -0,0 +1,43 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"testing"
+)
+
+func TestSortRecords(t *testing.T) {
+	// Records are a 4 byte key followed by a 4 byte sequence number.
+	cmp := func(a, b []byte) int { return bytes.Compare(a[:4], b[:4]) }
+	var c Cache
+	for _, n := range []int{0, 1, 2, 3, 7, 64, 1000} {
+		data := make([]byte, 8*n)
+		for i := 0; i < n; i++ {
+			binary.BigEndian.PutUint32(data[8*i:], uint32(rand.IntN(10)))
+			binary.BigEndian.PutUint32(data[8*i+4:], uint32(i))
+		}
+		want := make([][]byte, n)
+		for i := range want {
+			want[i] = append([]byte(nil), data[8*i:8*i+8]...)
+		}
+		sort.SliceStable(want, func(i, j int) bool { return cmp(want[i], want[j]) < 0 })
+		SortRecords(data, 8, cmp, &c)
+		if g, e := data, bytes.Join(want, nil); !bytes.Equal(g, e) && n != 0 {
+			t.Fatalf("n %d\n%x\n%x", n, g, e)
+		}
+	}
+	if n, _ := c.Stats(); n != 1 {
+		t.Fatal(n)
+	}
+
+	if err := recovered(func() { SortRecords(make([]byte, 5), 2, cmp, nil) }); !errors.Is(err, ErrInvalidSize) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"maps"
+)
+
+// SlotState is the lifecycle state of a buffer slot of Stack, see
+// SlotStates.
+type SlotState int
+
+// Values of SlotState.
+const (
+	// SlotEmpty is a free slot which never held a buffer.
+	SlotEmpty SlotState = iota
+
+	// SlotFree is a free slot retaining a buffer for reuse.
+	SlotFree
+
+	// SlotInUse is an allocated slot.
+	SlotInUse
+
+	// SlotTrimmed is a free slot whose buffer was dropped by Trim, the
+	// TTL, the soft limit or the slot caps.
+	SlotTrimmed
+
+	// SlotPoisoned is a free slot whose buffer was retired by the
+	// DetectEscapes mode and must not be reused.
+	SlotPoisoned
+)
+
+var slotStateNames = [...]string{
+	SlotEmpty:    "empty",
+	SlotFree:     "free",
+	SlotInUse:    "in-use",
+	SlotTrimmed:  "trimmed",
+	SlotPoisoned: "poisoned",
+}
+
+// String implements fmt.Stringer.
+func (s SlotState) String() string {
+	if s >= 0 && int(s) < len(slotStateNames) {
+		return slotStateNames[s]
+	}
+
+	return "SlotState(?)"
+}
+
+// SlotStates returns the current state of every slot. The slots are reported
+// in no particular order, except that the allocated ones come last, the most
+// recently allocated one first. It's intended for debugging tools visualizing
+// the behavior of the Stack.
+func (p *Stack) SlotStates() []SlotState {
+	r := make([]SlotState, cap(p.s))
+	for i, v := range p.s[:cap(p.s)] {
+		switch {
+		case i >= len(p.s):
+			r[i] = SlotInUse
+		case v.b != nil:
+			r[i] = SlotFree
+		default:
+			r[i] = v.gone
+		}
+	}
+	return r
+}
+
+// Transitions returns the number of times the slots entered each state. The
+// transitions are counted only in the debug modes, ie. with the Checked or
+// DetectEscapes options. Otherwise Transitions returns nil.
+func (p *Stack) Transitions() map[SlotState]uint64 { return maps.Clone(p.transitions) }
+
+// enter counts a transition to state st.
+func (p *Stack) enter(st SlotState) {
+	if p.transitions != nil {
+		p.transitions[st]++
+	}
+}
+
+// drop drops the buffer of the free slot s, which enters state st.
+func (p *Stack) drop(s *slot, st SlotState) {
+	p.bytes -= int64(cap(s.b))
+	if st != SlotPoisoned {
+		p.release(s.b)
+	}
+	s.b, s.gone = nil, st
+	p.enter(st)
+}
@@ -0,0 +1,39 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSlotStates(t *testing.T) {
+	clock := &testClock{t: time.Unix(0, 0)}
+	b := NewWithOptions(3, &Options{Checked: true, TTL: time.Second, Clock: clock})
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Free()
+	clock.advance(2 * time.Second)
+	b.Trim()
+	if g, e := fmt.Sprint(b.SlotStates()), "[empty trimmed in-use]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	b.Alloc(30)
+	b.Free()
+	if g, e := fmt.Sprint(b.SlotStates()), "[empty free in-use]"; g != e {
+		t.Fatal(g, e)
+	}
+
+	tr := b.Transitions()
+	if tr[SlotInUse] != 3 || tr[SlotFree] != 2 || tr[SlotTrimmed] != 1 {
+		t.Fatal(tr)
+	}
+
+	if b = NewStack(1); b.Transitions() != nil {
+		t.Fatal("transitions counted outside of the debug modes")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime"
+	"sync"
+)
+
+// SyncPool is a drop-in replacement of a sync.Pool of byte slices, stored
+// either as []byte or as *[]byte. Unlike sync.Pool, SyncPool is aware of the
+// buffer sizes: GetCap returns the smallest cached buffer big enough. Code
+// using sync.Pool can switch to SyncPool by changing the type of the variable
+// only and then start using GetCap where the needed size is known.
+//
+// The buffers are cached in a CCache. Like the content of a sync.Pool, they
+// are dropped at garbage collection, so an idle SyncPool does not keep memory
+// alive. MaxBytes optionally limits the memory retained in between.
+//
+// Items which are neither []byte nor *[]byte are rejected by Put. A zero
+// SyncPool is ready for use and it's safe for concurrent use by multiple
+// goroutines.
+type SyncPool struct {
+	// New optionally specifies a function to generate a value when Get
+	// would otherwise return nil.
+	New func() any
+
+	// MaxBytes, if positive, limits the combined capacity of the retained
+	// buffers. Put drops buffers which would exceed it.
+	MaxBytes int
+
+	c     CCache
+	mu    sync.Mutex
+	armed bool                   // A garbage collection drops the buffers.
+	items map[*byte]syncPoolItem // Cached buffers by their first byte.
+}
+
+type syncPoolItem struct {
+	p   *[]byte // Not nil if Put as *[]byte.
+	len int     // Length when Put.
+}
+
+// Get removes the smallest buffer from the pool and returns it, in the form
+// and with the length it was Put in. If the pool is empty, Get returns the result of
+// calling New or nil if New is nil.
+func (p *SyncPool) Get() any { return p.GetCap(1) }
+
+// GetCap is like Get, but it returns the smallest buffer having capacity of
+// at least n. If there's no such buffer, it returns the result of calling New
+// or nil if New is nil.
+func (p *SyncPool) GetCap(n int) any {
+	checkSize("SyncPool.GetCap", n)
+	p.mu.Lock()
+	b, ok := p.c.TryGet(max(n, 1))
+	if !ok {
+		p.mu.Unlock()
+		if p.New != nil {
+			return p.New()
+		}
+
+		return nil
+	}
+
+	b = b[:cap(b)]
+	it := p.items[&b[0]]
+	delete(p.items, &b[0])
+	p.mu.Unlock()
+	b = b[:it.len]
+	if it.p != nil {
+		*it.p = b
+		return it.p
+	}
+
+	return b
+}
+
+// Put adds x, a []byte or a *[]byte, to the pool. Other values, nil pointers
+// and buffers of zero capacity are ignored, as well as buffers exceeding
+// MaxBytes.
+func (p *SyncPool) Put(x any) {
+	var b []byte
+	var it syncPoolItem
+	switch v := x.(type) {
+	case []byte:
+		b = v
+	case *[]byte:
+		if v == nil {
+			return
+		}
+
+		b, it.p = *v, v
+	}
+	if cap(b) == 0 {
+		return
+	}
+
+	it.len = len(b)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.MaxBytes > 0 {
+		if _, bytes := p.c.Stats64(); bytes+int64(cap(b)) > int64(p.MaxBytes) {
+			return
+		}
+	}
+
+	if p.items == nil {
+		p.items = map[*byte]syncPoolItem{}
+	}
+	p.items[&b[:1][0]] = it
+	if !p.armed {
+		p.armed = true
+		runtime.SetFinalizer(new(gcSentinel), func(*gcSentinel) { p.collect() })
+	}
+	p.c.Put(b)
+}
+
+// gcSentinel is garbage collected at the next collection. It holds a pointer
+// so it's not batched by the tiny allocator with other, possibly live,
+// objects.
+type gcSentinel struct{ _ *byte }
+
+// collect drops the retained buffers after a garbage collection.
+func (p *SyncPool) collect() {
+	p.mu.Lock()
+	p.c.mu.Lock()
+	p.c.c, p.c.n, p.c.bytes = nil, 0, 0
+	p.c.mu.Unlock()
+	clear(p.items)
+	p.armed = false
+	p.mu.Unlock()
+}
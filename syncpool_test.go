@@ -0,0 +1,84 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSyncPool(t *testing.T) {
+	p := SyncPool{New: func() any { b := make([]byte, 0, 1); return &b }}
+	for _, n := range []int{10, 30, 20} {
+		b := make([]byte, n)
+		p.Put(&b)
+	}
+	p.Put(make([]byte, 5, 40))
+	p.Put("foo")
+	if g, e := cap(*p.GetCap(15).(*[]byte)), 20; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := cap(*p.Get().(*[]byte)), 10; g != e {
+		t.Fatal(g, e)
+	}
+
+	b := p.GetCap(31).([]byte)
+	if g, e := cap(b), 40; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := len(b), 5; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := cap(*p.GetCap(31).(*[]byte)), 1; g != e {
+		t.Fatal(g, e)
+	}
+
+	if g, e := cap(*p.Get().(*[]byte)), 30; g != e {
+		t.Fatal(g, e)
+	}
+
+	var q SyncPool
+	if q.Get() != nil {
+		t.Fatal("expected nil")
+	}
+}
+
+func TestSyncPoolMaxBytes(t *testing.T) {
+	p := SyncPool{MaxBytes: 100}
+	for i := 0; i < 5; i++ {
+		p.Put(make([]byte, 30))
+	}
+	if g, e := len(p.items), 3; g != e {
+		t.Fatal(g, e)
+	}
+
+	if _, bytes := p.c.Stats(); bytes > 100 {
+		t.Fatal(bytes)
+	}
+}
+
+func TestSyncPoolGC(t *testing.T) {
+	var p SyncPool
+	p.Put(make([]byte, 10))
+	for i := 0; i < 10; i++ {
+		if n, _ := p.c.Stats(); n == 0 {
+			break
+		}
+
+		runtime.GC()
+		runtime.Gosched()
+	}
+	if p.Get() != nil {
+		t.Fatal("buffers survived garbage collection")
+	}
+
+	p.Put(make([]byte, 10))
+	if p.Get() == nil {
+		t.Fatal("buffer not retained after a collection")
+	}
+}
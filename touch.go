@@ -0,0 +1,35 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"os"
+)
+
+var pageSize = os.Getpagesize()
+
+// touchPages writes to every memory page of the backing array of b, a newly
+// created, hence zeroed, buffer, see the TouchPages option.
+func touchPages(b []byte) {
+	b = b[:cap(b)]
+	if len(b) == 0 {
+		return
+	}
+
+	for i := 0; i < len(b); i += pageSize {
+		b[i] = 0
+	}
+	b[len(b)-1] = 0 // The last page, if b does not start at a page boundary.
+}
+
+// makeBuf returns a newly created buffer of length n and capacity c, see
+// makeBuf and the TouchPages option.
+func (p *Pool) makeBuf(n, c int) []byte {
+	r := makeBuf(p.labels, n, c)
+	if p.touch {
+		touchPages(r)
+	}
+	return r
+}
@@ -0,0 +1,46 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTouchPages(t *testing.T) {
+	const n = 1 << 20
+
+	zero := make([]byte, 4*n)
+	b := Make(WithSlots(1), WithTouchPages())
+	r := b.Alloc(n)
+	if !bytes.Equal(r, zero[:n]) {
+		t.Fatal("not zeroed")
+	}
+
+	if r = b.Grow(r, n); !bytes.Equal(r[:cap(r)], zero[:cap(r)]) {
+		t.Fatal("not zeroed")
+	}
+
+	b.Free()
+	p := NewPool(2, &Options{TouchPages: true, LargeThreshold: n})
+	for _, size := range []int{n / 2, 2 * n} {
+		r, err := p.AllocTimeout(size, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(r, zero[:size]) {
+			t.Fatal(size, "not zeroed")
+		}
+
+		p.Free(r)
+	}
+	p.PrewarmFromHistogram(Histogram{n: 1})
+	if g, _ := p.Stats(); g != 2 {
+		t.Fatal(g)
+	}
+
+	touchPages(nil)
+}
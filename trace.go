@@ -0,0 +1,38 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"context"
+	"runtime/trace"
+	"strconv"
+)
+
+// traceCategory is the category of the runtime/trace log events and the type
+// of the trace regions emitted by Stack.
+const traceCategory = "bufs"
+
+// traceAlloc logs an Alloc(n) of s and starts a region spanning the lifetime
+// of the allocation.
+func (p *Stack) traceAlloc(s *slot, n int) {
+	if !trace.IsEnabled() {
+		return
+	}
+
+	ctx := context.Background()
+	trace.Log(ctx, traceCategory, "Alloc "+strconv.Itoa(n)+" cap "+strconv.Itoa(cap(s.b)))
+	s.rgn = trace.StartRegion(ctx, traceCategory)
+}
+
+// traceFree ends the region of s started by traceAlloc and logs the Free.
+func (p *Stack) traceFree(s *slot) {
+	if s.rgn != nil {
+		s.rgn.End()
+		s.rgn = nil
+	}
+	if trace.IsEnabled() {
+		trace.Log(context.Background(), traceCategory, "Free cap "+strconv.Itoa(cap(s.b)))
+	}
+}
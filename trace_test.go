@@ -0,0 +1,28 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"runtime/trace"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	if err := trace.Start(&out); err != nil {
+		t.Skip(err)
+	}
+
+	b := NewWithOptions(2, &Options{Trace: true})
+	b.Alloc(10)
+	b.Alloc(20)
+	b.Free()
+	b.Free()
+	trace.Stop()
+	if !bytes.Contains(out.Bytes(), []byte("Alloc 20 cap 40")) {
+		t.Fatal("missing trace event")
+	}
+}
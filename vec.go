@@ -0,0 +1,67 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"fmt"
+	"net"
+)
+
+// AllocVec returns n buffers of length chunkSize, obtained using Get, as
+// net.Buffers suitable for vectored (writev) I/O. Calling release puts all
+// the buffers back to the cache. release must be called exactly once, after
+// the last use of v.
+//
+// It's fine to consume v using its WriteTo or Read methods before calling
+// release.
+func (c *Cache) AllocVec(chunkSize, n int) (v net.Buffers, release func()) {
+	checkVec("Cache.AllocVec", chunkSize, n)
+	return allocVec(chunkSize, n, c.Get, c.Put)
+}
+
+// checkVec panics with ErrInvalidSize if chunkSize or n, requested by op, is
+// negative.
+func checkVec(op string, chunkSize, n int) {
+	if chunkSize < 0 || n < 0 {
+		panic(fmt.Errorf("%s: %d buffers of size %d: %w", op, n, chunkSize, ErrInvalidSize))
+	}
+}
+
+func allocVec(chunkSize, n int, get func(int) []byte, put func([]byte)) (v net.Buffers, release func()) {
+	// net.Buffers methods nil the consumed items of v, so the chunks are
+	// tracked separately.
+	chunks := make([][]byte, 2*n)
+	for i := 0; i < n; i++ {
+		chunks[i] = get(chunkSize)
+	}
+	copy(chunks[n:], chunks[:n])
+	return net.Buffers(chunks[n:]), func() {
+		for _, b := range chunks[:n] {
+			put(b)
+		}
+	}
+}
+
+// AllocVec returns n buffers of length chunkSize, obtained using Get, as
+// net.Buffers suitable for vectored (writev) I/O. Calling release puts all
+// the buffers back to the cache. release must be called exactly once, after
+// the last use of v.
+//
+// It's fine to consume v using its WriteTo or Read methods before calling
+// release.
+func (c *CCache) AllocVec(chunkSize, n int) (v net.Buffers, release func()) {
+	checkVec("CCache.AllocVec", chunkSize, n)
+	c.mu.Lock()
+	v, put := allocVec(chunkSize, n, func(n int) []byte {
+		r, _ := c.get(n)
+		return r
+	}, c.put)
+	c.mu.Unlock()
+	return v, func() {
+		c.mu.Lock()
+		put()
+		c.mu.Unlock()
+	}
+}
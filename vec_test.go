@@ -0,0 +1,46 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAllocVec(t *testing.T) {
+	var c CCache
+	v, release := c.AllocVec(4, 3)
+	for i, b := range v {
+		copy(b, []byte{byte('a' + i), byte('a' + i), byte('a' + i), byte('a' + i)})
+	}
+
+	var w bytes.Buffer
+	if _, err := v.WriteTo(&w); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := w.String(), "aaaabbbbcccc"; g != e {
+		t.Fatal(g, e)
+	}
+
+	release()
+	if n, bytes := c.Stats(); n != 3 || bytes != 3*8 {
+		t.Fatal(n, bytes)
+	}
+}
+
+func TestAllocVecInvalid(t *testing.T) {
+	var c CCache
+	for _, v := range [][2]int{{-1, 2}, {2, -1}} {
+		if err := recovered(func() { c.AllocVec(v[0], v[1]) }); !errors.Is(err, ErrInvalidSize) {
+			t.Fatal(v, err)
+		}
+	}
+
+	// The cache must not be left locked.
+	_, release := c.AllocVec(1, 1)
+	release()
+}
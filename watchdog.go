@@ -0,0 +1,37 @@
+// Copyright 2014 The bufs Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufs
+
+import (
+	"runtime/debug"
+)
+
+// watch arms the watchdog for b, see the Watchdog option. It must be called
+// with p.mu held.
+func (p *Pool) watch(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	stack := debug.Stack()
+	p.holds[addr(b)] = afterFunc(p.clock, p.watchdog, func() {
+		p.mu.Lock()
+		note := p.note(b)
+		p.mu.Unlock()
+		p.emit(Event{Kind: EventHeldTooLong, Time: p.clock.Now(), Stack: stack, Note: note})
+	})
+}
+
+// unwatch disarms the watchdog for b. It must be called with p.mu held.
+func (p *Pool) unwatch(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+
+	if t := p.holds[addr(b)]; t != nil {
+		t.Stop()
+		delete(p.holds, addr(b))
+	}
+}